@@ -0,0 +1,167 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// AckStyle How a gift is acknowledged to the giver
+type AckStyle string
+
+const (
+	// ReactionsAck React with the number given, replying in thread when the reactions can not tell it all
+	ReactionsAck AckStyle = "reactions"
+	// ThreadAck Reply in the message thread with a summary by receiver
+	ThreadAck AckStyle = "thread"
+	// EphemeralAck Show the summary to the giver only
+	EphemeralAck AckStyle = "ephemeral"
+	// NoAck Do not acknowledge gifts
+	NoAck AckStyle = "none"
+)
+
+// ackStyles Supported acknowledgment styles
+var ackStyles = []AckStyle{ReactionsAck, ThreadAck, EphemeralAck, NoAck}
+
+const remainingFormat = "You have %s left today"
+
+// ackStyleOr Parse the acknowledgment style, the fallback when it is not supported
+func ackStyleOr(name string, fallback AckStyle) AckStyle {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, style := range ackStyles {
+		if string(style) == name {
+			return style
+		}
+	}
+	return fallback
+}
+
+// parseChannelPairs Parse "channel:value" pairs separated by commas, the error names the malformed entries
+func parseChannelPairs(config string) (map[string]string, error) {
+	result := map[string]string{}
+	var malformed []string
+	for _, entry := range splitList(config) {
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 || parts[0] == "" {
+			malformed = append(malformed, entry)
+			continue
+		}
+		result[parts[0]] = strings.TrimSpace(parts[1])
+	}
+	if len(malformed) > 0 {
+		return result, fmt.Errorf("malformed entries %v, expected channel:value", malformed)
+	}
+	return result, nil
+}
+
+// ackStyleOf Acknowledgment style of the channel
+func (cfg *Config) ackStyleOf(channel string) AckStyle {
+	if style, ok := cfg.AckChannels[channel]; ok {
+		return style
+	}
+	return cfg.AckStyle
+}
+
+// acknowledge Tell the giver what was given following the style of the channel, nothing when it is none.
+// When nothing was given the rejection reaction depends on the feedback style of the channel.
+// remaining is nil when the allowance of the giver was not read, e.g. when every receiver was rejected.
+func acknowledge(g gift, outcomes []receiverOutcome, given map[string]int, limitReached bool, trimmed bool, remaining map[string]int) {
+	cfg := g.Team.Config
+	reacts := cfg.feedbackStyleOf(g.Channel).reacts()
+	style := g.Profile.Ack
+	if style == "" {
+		style = cfg.ackStyleOf(g.Channel)
+	}
+	switch style {
+	case NoAck:
+		return
+	case ThreadAck:
+		postInThread(g.Team, g.Channel, g.TimeStamp, ackSummary(cfg, outcomes, remaining))
+	case EphemeralAck:
+		postEphemeral(g.Team, g.Channel, g.Giver.ID, ackSummary(cfg, outcomes, remaining))
+	default:
+		reactions := ackReactions(cfg, given)
+		switch {
+		case len(reactions) > 0 && hasDuplicates(reactions):
+			// Slack rejects the same reaction twice, e.g. 11, so the count could not be read
+			postInThread(g.Team, g.Channel, g.TimeStamp, ackSummary(cfg, outcomes, remaining))
+			return
+		case len(reactions) > 0:
+			// One after the other so each number stays next to its currency
+			background(func() {
+				for _, e := range reactions {
+					react(g.Team, g.Channel, g.TimeStamp, e)
+				}
+			})
+		case !reacts:
+			return
+		case limitReached:
+			background(func() { react(g.Team, g.Channel, g.TimeStamp, string(NoGood)) })
+			return
+		case len(outcomes) == 1 && outcomes[0].Reason == selfGivingReason:
+			// Keep the single receiver reactions so nothing changes for the common case
+			background(func() { react(g.Team, g.Channel, g.TimeStamp, string(Pray)) })
+			return
+		default:
+			background(func() { react(g.Team, g.Channel, g.TimeStamp, string(NotAllow)) })
+		}
+		if len(outcomes) > 1 || trimmed {
+			replyOutcomes(g.Team, g.Channel, g.TimeStamp, outcomes)
+		}
+	}
+}
+
+// ackReactions Reactions telling the quantity given of each currency: the number alone when one currency was given,
+// otherwise each number followed by its currency, e.g. two, taco, one, rocket for 2 :taco: and 1 :rocket:
+func ackReactions(cfg *Config, given map[string]int) []string {
+	var currencies []currency
+	for _, c := range cfg.currencies {
+		if given[c.Name] > 0 {
+			currencies = append(currencies, c)
+		}
+	}
+	if len(currencies) == 1 {
+		return getNumberEmoji(given[currencies[0].Name])
+	}
+	var reactions []string
+	for _, c := range currencies {
+		reactions = append(append(reactions, getNumberEmoji(given[c.Name])...), c.Name)
+	}
+	return reactions
+}
+
+// ackSummary Render one line by receiver and the remaining balance of the giver
+func ackSummary(cfg *Config, outcomes []receiverOutcome, remaining map[string]int) string {
+	var lines []string
+	for _, outcome := range outcomes {
+		lines = append(lines, outcome.String())
+	}
+	if remaining != nil {
+		lines = append(lines, fmt.Sprintf(remainingFormat, formatQuantities(cfg, remaining)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hasDuplicates Whether a value appears more than once
+func hasDuplicates(values []string) bool {
+	seen := map[string]bool{}
+	for _, value := range values {
+		if seen[value] {
+			return true
+		}
+		seen[value] = true
+	}
+	return false
+}
+
+// postEphemeral Post message visible only to the user in the channel
+func postEphemeral(t *team, channel string, user string, text string) {
+	timestamp, err := t.client.PostEphemeral(channel, user, slack.MsgOptionText(text, false))
+	if err != nil {
+		log.Printf("Unable to post ephemeral message to user %v in channel %v with error %v\n", user, channel, err)
+		return
+	}
+	log.Printf("Ephemeral message posted to user %v in channel %v at %v\n", user, channel, timestamp)
+}
@@ -0,0 +1,490 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// Adjustment Kind of ledger row written by an admin command. Rows are never edited, adjustments are appended.
+type Adjustment string
+
+const (
+	// RevokeAdjustment Cancel a gift with the opposite quantity, dated like the gift so its periods are corrected
+	RevokeAdjustment Adjustment = "revoke"
+	// GrantAdjustment Give without spending the allowance of the admin
+	GrantAdjustment Adjustment = "grant"
+	// ResetLimitAdjustment Give back what the user gave today to their allowance, without changing charts
+	ResetLimitAdjustment Adjustment = "reset-limit"
+	// BanAdjustment Stop the user from giving and receiving
+	BanAdjustment Adjustment = "ban"
+	// UnbanAdjustment Lift the ban of the user
+	UnbanAdjustment Adjustment = "unban"
+)
+
+// ranks Whether rows of the adjustment count in charts, stats and the home tab
+func (a Adjustment) ranks() bool {
+	return a != ResetLimitAdjustment && a != BanAdjustment && a != UnbanAdjustment
+}
+
+// spendsAllowance Whether rows of the adjustment count towards the daily limit of the giver
+func (a Adjustment) spendsAllowance() bool {
+	return a == "" || a == RevokeAdjustment || a == ResetLimitAdjustment
+}
+
+// Role What a user is allowed to do with admin commands, each role includes the lower ones
+type Role int
+
+const (
+	// MemberRole No admin command
+	MemberRole Role = iota
+	// ModeratorRole Revoke gifts and reset limits
+	ModeratorRole
+	// AdminRole Every admin command
+	AdminRole
+)
+
+func (r Role) String() string {
+	return map[Role]string{MemberRole: "members", ModeratorRole: "moderators", AdminRole: "admins"}[r]
+}
+
+const adminUsageMessage = "Usage: ```admin revoke <message link> [reason]\n" +
+	"admin grant @user <number> [emoji] <reason>\n" +
+	"admin reset-limit @user\n" +
+	"admin ban @user [reason]\n" +
+	"admin unban @user\n" +
+	"admin config\n" +
+	"admin config set <NAME> [value]\n" +
+	"admin config channel ...\n" +
+	"admin audit [day|week|sprint|month|year]```"
+const roleRequiredFormat = "Only %s can do that."
+const noGiftMessage = "No gift is recorded for that message."
+const alreadyRevokedMessage = "That message was already revoked."
+const revokedFormat = "Revoked %d gift(s) of that message: %s"
+const grantedFormat = "Granted %d %s to <@%s>."
+const nothingGivenTodayFormat = "<@%s> has not given anything today."
+const limitResetFormat = "Daily limit of <@%s> reset, %s given back."
+const alreadyBannedFormat = "<@%s> is already banned."
+const notBannedFormat = "<@%s> is not banned."
+const bannedFormat = "<@%s> is banned, gifts from and to them do not count anymore."
+const unbannedFormat = "<@%s> is not banned anymore."
+const grantBannedFormat = "<@%s> is banned, unban them before granting."
+const adjustmentTextFormat = "%s by %s: %s"
+const settingsVersionFormat = "Settings version *%s*:\n%s"
+const noSettingsText = "no setting overrides the environment"
+const globalSettingsMessage = "Settings apply to every workspace the app is installed in, " +
+	"so they can only be changed from the workspace of SLACK_TOKEN or in the Settings sheet. Use `config channel` for this workspace."
+
+// userMentionPattern User mention of a slash command text, e.g. <@U123|name>
+var userMentionPattern = regexp.MustCompile(`^<@(\w+)(?:\|[^>]*)?>$`)
+
+// messageLinkPattern Permalink of a message, e.g. https://team.slack.com/archives/C123/p1547921475007300
+var messageLinkPattern = regexp.MustCompile(`/archives/(\w+)/(p\d+)`)
+
+// adminCommand An admin sub command with the role it requires
+type adminCommand struct {
+	Role Role
+	// Handle Run the command for the admin in the channel with the arguments following its name, returning the response
+	Handle func(t *team, admin *slack.User, channel string, args []string) string
+}
+
+// adminCommands Admin sub commands by name
+var adminCommands = map[string]adminCommand{
+	"revoke":      {Role: ModeratorRole, Handle: adminRevoke},
+	"grant":       {Role: AdminRole, Handle: adminGrant},
+	"reset-limit": {Role: ModeratorRole, Handle: adminResetLimit},
+	"ban":         {Role: AdminRole, Handle: adminBan},
+	"unban":       {Role: AdminRole, Handle: adminUnban},
+	"config":      {Role: AdminRole, Handle: adminConfig},
+	"audit":       {Role: AdminRole, Handle: adminAudit},
+}
+
+// roleOf Role of the user from the configured users and user groups only.
+// Workspace admins and owners are not admins of the app, an admin of any installed workspace could change the settings of all.
+func roleOf(t *team, user *slack.User) Role {
+	cfg := t.Config
+	if containsString(cfg.AdminUsers, user.ID) || inUserGroup(t, cfg.AdminGroup, user.ID) {
+		return AdminRole
+	}
+	if containsString(cfg.ModeratorUsers, user.ID) || inUserGroup(t, cfg.ModeratorGroup, user.ID) {
+		return ModeratorRole
+	}
+	return MemberRole
+}
+
+// inUserGroup Whether the user is a member of the user group, false when no group is configured
+func inUserGroup(t *team, group string, userID string) bool {
+	if group == "" {
+		return false
+	}
+	members, err := t.client.GetUserGroupMembers(group)
+	if err != nil {
+		log.Printf("Unable to get members of user group %v with error %v\n", group, err)
+		return false
+	}
+	return containsString(members, userID)
+}
+
+// isAdmin Whether the user is allowed to run every admin command
+func isAdmin(t *team, userID string) bool {
+	user, err := t.client.GetUserInfo(userID)
+	if err != nil {
+		log.Printf("Error getting user %v info %v\n", userID, err)
+		return false
+	}
+	return roleOf(t, user) >= AdminRole
+}
+
+// handleAdmin Run the admin command if the user has its role, args follow the admin word
+func handleAdmin(t *team, userID string, channel string, args []string) string {
+	if len(args) == 0 {
+		return adminUsageMessage
+	}
+	command, ok := adminCommands[strings.ToLower(args[0])]
+	if !ok {
+		return adminUsageMessage
+	}
+	admin, err := t.client.GetUserInfo(userID)
+	if err != nil {
+		log.Printf("Error getting admin %v info %v\n", userID, err)
+		return err.Error()
+	}
+	if roleOf(t, admin) < command.Role {
+		log.Printf("User %v is not allowed to run admin %v\n", userID, args[0])
+		return fmt.Sprintf(roleRequiredFormat, command.Role)
+	}
+	log.Printf("Admin command %v by user %v\n", args, userID)
+	return command.Handle(t, admin, channel, args[1:])
+}
+
+// mentionedUser Resolve the user mentioned by the argument
+func mentionedUser(t *team, arg string) (*slack.User, bool) {
+	match := userMentionPattern.FindStringSubmatch(arg)
+	if match == nil {
+		return nil, false
+	}
+	user, err := t.client.GetUserInfo(match[1])
+	if err != nil {
+		log.Printf("Error getting user %v info %v\n", match[1], err)
+		return nil, false
+	}
+	return user, true
+}
+
+// messageID Id of the message with the timestamp as in its permalink, e.g. p1547921475007300 for 1547921475.007300
+func messageID(timestamp string) string {
+	if timestamp == "" {
+		return ""
+	}
+	return "p" + strings.Replace(timestamp, ".", "", 1)
+}
+
+// isOf Whether the entry was recorded for the message.
+// Rows written before messages were stored never match, the second they were posted could be another message's.
+func (entry ledgerEntry) isOf(channel string, id string) bool {
+	return entry.MessageID != "" && entry.Channel == channel && entry.MessageID == id
+}
+
+// isBanned Whether the latest ban or unban of the user in the entries is a ban, by user id as real names may change
+func isBanned(entries []ledgerEntry, userID string) bool {
+	banned := false
+	for _, entry := range entries {
+		if entry.ReceiverID != userID {
+			continue
+		}
+		switch entry.Adjustment {
+		case BanAdjustment:
+			banned = true
+		case UnbanAdjustment:
+			banned = false
+		}
+	}
+	return banned
+}
+
+// adjustmentText Text of an adjustment row naming the admin, e.g. "revoke by Jane: duplicate"
+func adjustmentText(adjustment Adjustment, admin *slack.User, reason string) string {
+	return fmt.Sprintf(adjustmentTextFormat, adjustment, admin.Profile.RealName, reason)
+}
+
+// appendAdjustment Append the adjustment row to the ledger of the workspace
+func appendAdjustment(t *team, entry ledgerEntry) error {
+	row := entry.row(t)
+	log.Printf("Adjustment to write %v\n", row)
+	return appendRow(t.Config, row)
+}
+
+// ledgerError Log the ledger read error of the admin command and tell the admin
+func ledgerError(err error) string {
+	log.Printf("Unable to read the ledger with error %v\n", err)
+	return ledgerUnavailableMessage
+}
+
+// adminRevoke Cancel every gift of the linked message with rows of the opposite quantity
+func adminRevoke(t *team, admin *slack.User, channel string, args []string) string {
+	if len(args) == 0 {
+		return adminUsageMessage
+	}
+	match := messageLinkPattern.FindStringSubmatch(args[0])
+	if match == nil {
+		return adminUsageMessage
+	}
+	messageChannel, id := match[1], match[2]
+	entries, err := readLedger(t)
+	if err != nil {
+		return ledgerError(err)
+	}
+	var gifts []ledgerEntry
+	for _, entry := range entries {
+		if !entry.isOf(messageChannel, id) {
+			continue
+		}
+		switch entry.Adjustment {
+		case RevokeAdjustment:
+			return alreadyRevokedMessage
+		case "":
+			gifts = append(gifts, entry)
+		}
+	}
+	if len(gifts) == 0 {
+		return noGiftMessage
+	}
+	reason := strings.Join(args[1:], " ")
+	text := adjustmentText(RevokeAdjustment, admin, reason)
+	var rows [][]interface{}
+	var lines []string
+	for _, gift := range gifts {
+		reversal := gift
+		reversal.Quantity = -gift.Quantity
+		reversal.Message = text
+		reversal.Channel = messageChannel
+		reversal.MessageID = id
+		reversal.Adjustment = RevokeAdjustment
+		rows = append(rows, reversal.row(t))
+		lines = append(lines, fmt.Sprintf(giftOutFormat, gift.Quantity, fmt.Sprintf(":%s:", gift.Currency), gift.Receiver, gift.Time.Format(homeGiftDateFormat)))
+	}
+	log.Printf("Reversals to write %v\n", rows)
+	// At once, so a failure can not leave the message half revoked
+	if err := appendRows(t.Config, rows); err != nil {
+		log.Printf("Unable to revoke gifts of message %v with error %v\n", args[0], err)
+		return fmt.Sprintf("Unable to revoke the gifts: %v", err)
+	}
+	auditAdmin(t, admin, string(RevokeAdjustment), args[0], strings.Join(lines, "; "), "revoked", reason)
+	return fmt.Sprintf(revokedFormat, len(gifts), "\n"+strings.Join(lines, "\n"))
+}
+
+// adminGrant Give emoji of the default or named currency to the user, outside of any allowance
+func adminGrant(t *team, admin *slack.User, channel string, args []string) string {
+	if len(args) < 3 {
+		return adminUsageMessage
+	}
+	user, ok := mentionedUser(t, args[0])
+	if !ok {
+		return adminUsageMessage
+	}
+	quantity, err := strconv.Atoi(args[1])
+	if err != nil || quantity < 1 {
+		return adminUsageMessage
+	}
+	c := t.Config.defaultCurrency()
+	args = args[2:]
+	if named, ok := t.Config.currencyNamed(args[0]); ok {
+		c = named
+		args = args[1:]
+	}
+	reason := strings.Join(args, " ")
+	if reason == "" {
+		return adminUsageMessage
+	}
+	entries, err := readLedger(t)
+	if err != nil {
+		return ledgerError(err)
+	}
+	if isBanned(entries, user.ID) {
+		return fmt.Sprintf(grantBannedFormat, user.ID)
+	}
+	err = appendAdjustment(t, ledgerEntry{
+		Time:       t.Config.now(),
+		Giver:      admin.Profile.RealName,
+		Receiver:   user.Profile.RealName,
+		GiverID:    admin.ID,
+		ReceiverID: user.ID,
+		Quantity:   quantity,
+		Message:    adjustmentText(GrantAdjustment, admin, reason),
+		Source:     AdminSource,
+		Currency:   c.Name,
+		Weight:     1,
+		Channel:    channel,
+		Adjustment: GrantAdjustment,
+	})
+	if err != nil {
+		log.Printf("Unable to grant %v with error %v\n", user.ID, err)
+		return fmt.Sprintf("Unable to grant: %v", err)
+	}
+	auditAdmin(t, admin, string(GrantAdjustment), fmt.Sprintf("<@%s>", user.ID), "", fmt.Sprintf("%d %s", quantity, c.Emoji()), reason)
+	background(func() { publishHome(t, user.ID, "") })
+	return fmt.Sprintf(grantedFormat, quantity, c.Emoji(), user.ID)
+}
+
+// adminResetLimit Give back to the user what they gave today with rows that only count towards the daily limit
+func adminResetLimit(t *team, admin *slack.User, channel string, args []string) string {
+	if len(args) != 1 {
+		return adminUsageMessage
+	}
+	user, ok := mentionedUser(t, args[0])
+	if !ok {
+		return adminUsageMessage
+	}
+	entries, err := readLedger(t)
+	if err != nil {
+		return ledgerError(err)
+	}
+	givenToday := givenTodayIn(t.Config, entries, user.Profile.RealName)
+	var names []string
+	for name, quantity := range givenToday {
+		if quantity > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf(nothingGivenTodayFormat, user.ID)
+	}
+	sort.Strings(names)
+	var rows [][]interface{}
+	for _, name := range names {
+		entry := ledgerEntry{
+			Time:       t.Config.now(),
+			Giver:      user.Profile.RealName,
+			GiverID:    user.ID,
+			Quantity:   -givenToday[name],
+			Message:    adjustmentText(ResetLimitAdjustment, admin, ""),
+			Source:     AdminSource,
+			Currency:   name,
+			Weight:     1,
+			Channel:    channel,
+			Adjustment: ResetLimitAdjustment,
+		}
+		rows = append(rows, entry.row(t))
+	}
+	log.Printf("Adjustments to write %v\n", rows)
+	if err := appendRows(t.Config, rows); err != nil {
+		log.Printf("Unable to reset the limit of %v with error %v\n", user.ID, err)
+		return fmt.Sprintf("Unable to reset the limit: %v", err)
+	}
+	auditAdmin(t, admin, string(ResetLimitAdjustment), fmt.Sprintf("<@%s>", user.ID), formatQuantities(t.Config, givenToday), "nothing given today", "")
+	background(func() { publishHome(t, user.ID, "") })
+	return fmt.Sprintf(limitResetFormat, user.ID, formatQuantities(t.Config, givenToday))
+}
+
+// adminBan Stop the user from giving and receiving
+func adminBan(t *team, admin *slack.User, channel string, args []string) string {
+	return setBanned(t, admin, channel, args, true)
+}
+
+// adminUnban Lift the ban of the user
+func adminUnban(t *team, admin *slack.User, channel string, args []string) string {
+	return setBanned(t, admin, channel, args, false)
+}
+
+// setBanned Append a ban or unban row for the mentioned user, the arguments following it are the reason
+func setBanned(t *team, admin *slack.User, channel string, args []string, banned bool) string {
+	if len(args) == 0 {
+		return adminUsageMessage
+	}
+	user, ok := mentionedUser(t, args[0])
+	if !ok {
+		return adminUsageMessage
+	}
+	entries, err := readLedger(t)
+	if err != nil {
+		return ledgerError(err)
+	}
+	if isBanned(entries, user.ID) == banned {
+		if banned {
+			return fmt.Sprintf(alreadyBannedFormat, user.ID)
+		}
+		return fmt.Sprintf(notBannedFormat, user.ID)
+	}
+	adjustment, format := BanAdjustment, bannedFormat
+	if !banned {
+		adjustment, format = UnbanAdjustment, unbannedFormat
+	}
+	reason := strings.Join(args[1:], " ")
+	err = appendAdjustment(t, ledgerEntry{
+		Time:       t.Config.now(),
+		Giver:      admin.Profile.RealName,
+		Receiver:   user.Profile.RealName,
+		GiverID:    admin.ID,
+		ReceiverID: user.ID,
+		Message:    adjustmentText(adjustment, admin, reason),
+		Source:     AdminSource,
+		Currency:   t.Config.defaultCurrency().Name,
+		Weight:     1,
+		Channel:    channel,
+		Adjustment: adjustment,
+	})
+	if err != nil {
+		log.Printf("Unable to %v %v with error %v\n", adjustment, user.ID, err)
+		return fmt.Sprintf("Unable to %v: %v", adjustment, err)
+	}
+	status := map[bool]string{true: "banned", false: "not banned"}
+	auditAdmin(t, admin, string(adjustment), fmt.Sprintf("<@%s>", user.ID), status[!banned], status[banned], reason)
+	return fmt.Sprintf(format, user.ID)
+}
+
+// adminConfig Show the runtime settings, change one, or manage the channel profile
+func adminConfig(t *team, admin *slack.User, channel string, args []string) string {
+	if len(args) == 0 {
+		settings, _, err := readSettings(t.Config)
+		if err != nil {
+			log.Printf("Unable to read settings with error %v\n", err)
+			return fmt.Sprintf("Unable to read the settings: %v", err)
+		}
+		return fmt.Sprintf(settingsVersionFormat, versionOf(t.Config), formatSettings(settings))
+	}
+	switch strings.ToLower(args[0]) {
+	case "channel":
+		return handleConfigChannel(t, admin.ID, channel, args[1:])
+	case "set":
+		if len(args) < 2 {
+			return adminUsageMessage
+		}
+		if !t.Legacy {
+			// The Settings sheet applies to every workspace, only the one of SLACK_TOKEN owns it
+			return globalSettingsMessage
+		}
+		name := strings.ToUpper(args[1])
+		value := strings.Join(args[2:], " ")
+		previous, err := saveSetting(t.Config, name, value)
+		if err != nil {
+			log.Printf("Unable to save setting %v with error %v\n", name, err)
+			return fmt.Sprintf("Unable to save %v: %v", name, err)
+		}
+		log.Printf("Setting %v saved as %q by user %v\n", name, value, admin.ID)
+		auditAdmin(t, admin, "config set", name, previous, value, "")
+		return fmt.Sprintf("%s%s is now %q.", settingsSavedMessage, name, value)
+	}
+	return adminUsageMessage
+}
+
+// formatSettings Render the settings one per line in name order
+func formatSettings(settings map[string]string) string {
+	if len(settings) == 0 {
+		return noSettingsText
+	}
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("`%s` = %s", name, settings[name]))
+	}
+	return strings.Join(lines, "\n")
+}
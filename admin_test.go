@@ -0,0 +1,74 @@
+package p
+
+import (
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestIsBanned(t *testing.T) {
+	entries := []ledgerEntry{
+		{Receiver: "Jane", ReceiverID: "U1", Adjustment: BanAdjustment},
+		{Receiver: "Jane", ReceiverID: "U2", Adjustment: BanAdjustment},
+		{Receiver: "Jane", ReceiverID: "U2", Adjustment: UnbanAdjustment},
+		{Receiver: "Jane", ReceiverID: "U3", Quantity: 1},
+	}
+	tests := []struct {
+		userID string
+		want   bool
+	}{
+		{"U1", true},
+		{"U2", false},
+		{"U3", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := isBanned(entries, test.userID); got != test.want {
+			t.Errorf("isBanned(%q) = %v, want %v", test.userID, got, test.want)
+		}
+	}
+}
+
+func TestLedgerEntryIsOf(t *testing.T) {
+	gift := ledgerEntry{Channel: "C1", MessageID: "p1547921475007300"}
+	if !gift.isOf("C1", "p1547921475007300") {
+		t.Error("isOf() of the message = false, want true")
+	}
+	if gift.isOf("C2", "p1547921475007300") {
+		t.Error("isOf() of another channel = true, want false")
+	}
+	legacy := ledgerEntry{}
+	if legacy.isOf("C1", "p1547921475007300") {
+		t.Error("isOf() of a row without message = true, want false")
+	}
+}
+
+func TestRoleOf(t *testing.T) {
+	cfg := testConfig()
+	cfg.AdminUsers = []string{"U1"}
+	cfg.ModeratorUsers = []string{"U2"}
+	tm := &team{ID: "T1", Config: cfg}
+	tests := []struct {
+		name string
+		user *slack.User
+		want Role
+	}{
+		{"configured admin", &slack.User{ID: "U1"}, AdminRole},
+		{"configured moderator", &slack.User{ID: "U2"}, ModeratorRole},
+		{"workspace owner", &slack.User{ID: "U3", IsAdmin: true, IsOwner: true}, MemberRole},
+		{"member", &slack.User{ID: "U4"}, MemberRole},
+	}
+	for _, test := range tests {
+		if got := roleOf(tm, test.user); got != test.want {
+			t.Errorf("roleOf(%v) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAdminConfigSetFromInstalledWorkspace(t *testing.T) {
+	tm := &team{ID: "T2", Config: testConfig()}
+	got := adminConfig(tm, &slack.User{ID: "U1"}, "C1", []string{"set", "MAX_EVERYDAY", "10"})
+	if got != globalSettingsMessage {
+		t.Errorf("adminConfig(set) = %q, want %q", got, globalSettingsMessage)
+	}
+}
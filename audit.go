@@ -0,0 +1,175 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"google.golang.org/api/sheets/v4"
+)
+
+// auditSheet Sheet recording administrative and automated actions, one row per action:
+// Time, Team, Actor, Action, Target, Before, After, Reason. Rows are only appended.
+// The sheet is added with its header by the first event when the spreadsheet has none.
+const auditSheet = "Audit"
+const auditColumns = 8
+
+// auditHeader Header row of the audit sheet
+var auditHeader = []interface{}{"Time", "Team", "Actor", "Action", "Target", "Before", "After", "Reason"}
+
+// auditLimit Most events listed by the audit command, the latest ones
+const auditLimit = 30
+
+// settingsActor Actor of the settings versions loaded from the Settings sheet
+const settingsActor = "Settings sheet"
+
+const noAuditFormat = "No audit event this %s."
+const auditFormat = "Audit events this %s%s:\n%s"
+const auditLineFormat = "%s %s *%s* %s%s%s"
+
+// auditEvent An action changing gifts, users or the configuration.
+// Actor and Target are Slack mentions when they are users or channels so the audit command renders their names.
+type auditEvent struct {
+	Time   time.Time
+	Team   string
+	Actor  string
+	Action string
+	Target string
+	Before string
+	After  string
+	Reason string
+}
+
+// recordAudit Append the event to the audit sheet, stamped now. An empty team means every workspace.
+func recordAudit(cfg *Config, event auditEvent) {
+	if event.Time.IsZero() {
+		event.Time = cfg.now()
+	}
+	var valueRange sheets.ValueRange
+	valueRange.Values = append(valueRange.Values, []interface{}{
+		event.Time.Format(time.RFC3339), event.Team, event.Actor, event.Action, event.Target, event.Before, event.After, event.Reason,
+	})
+	appendEvent := func() error {
+		_, err := sheetsService().Spreadsheets.Values.Append(cfg.SpreadsheetID, auditSheet+"!A2", &valueRange).ValueInputOption("RAW").Do()
+		return err
+	}
+	err := appendEvent()
+	if isMissingSheet(err) {
+		// Another event may have added it meanwhile, appending tells
+		if err := addSheet(cfg, auditSheet, auditHeader); err != nil {
+			log.Printf("Unable to add sheet %v with error %v\n", auditSheet, err)
+		}
+		err = appendEvent()
+	}
+	if err != nil {
+		log.Printf("Unable to record audit event %+v with error %v\n", event, err)
+		return
+	}
+	log.Printf("Audit event recorded %+v\n", event)
+}
+
+// auditAdmin Record the action the admin ran in the workspace
+func auditAdmin(t *team, admin *slack.User, action string, target string, before string, after string, reason string) {
+	event := auditEvent{Team: t.ID, Actor: fmt.Sprintf("<@%s>", admin.ID), Action: action, Target: target, Before: before, After: after, Reason: reason}
+	background(func() { recordAudit(t.Config, event) })
+}
+
+// readAudit Read the events of the workspace and those of every workspace, in the order they were recorded
+func readAudit(t *team) ([]auditEvent, error) {
+	var events []auditEvent
+	response, err := sheetsService().Spreadsheets.Values.Get(t.Config.SpreadsheetID, auditSheet+"!A2:H").Do()
+	if isMissingSheet(err) {
+		// Nothing was recorded yet
+		return events, nil
+	}
+	if err != nil {
+		return events, err
+	}
+	for _, row := range response.Values {
+		cells := make([]string, auditColumns)
+		for j := 0; j < len(row) && j < auditColumns; j++ {
+			cells[j] = fmt.Sprintf("%v", row[j])
+		}
+		if cells[1] != "" && cells[1] != t.ID {
+			continue
+		}
+		recorded, err := time.Parse(time.RFC3339, cells[0])
+		if err != nil {
+			log.Printf("Skip audit row %v with error %v\n", row, err)
+			continue
+		}
+		events = append(events, auditEvent{
+			Time:   recorded,
+			Team:   cells[1],
+			Actor:  cells[2],
+			Action: cells[3],
+			Target: cells[4],
+			Before: cells[5],
+			After:  cells[6],
+			Reason: cells[7],
+		})
+	}
+	return events, nil
+}
+
+// adminAudit List the latest events of the period, the day by default
+func adminAudit(t *team, admin *slack.User, channel string, args []string) string {
+	period := Day
+	if len(args) > 0 {
+		named, ok := durationNamed(args[0])
+		if !ok {
+			return adminUsageMessage
+		}
+		period = named
+	}
+	from, to, failed := calculateRangeFrom(t.Config, period)
+	if failed {
+		return adminUsageMessage
+	}
+	events, err := readAudit(t)
+	if err != nil {
+		log.Printf("Unable to read audit events with error %v\n", err)
+		return fmt.Sprintf("Unable to read the audit events: %v", err)
+	}
+	var lines []string
+	for _, event := range events {
+		if isInRange(event.Time, from, to) {
+			lines = append(lines, describeAudit(t.Config, event))
+		}
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf(noAuditFormat, strings.ToLower(string(period)))
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	more := ""
+	if len(lines) > auditLimit {
+		more = fmt.Sprintf(", latest %d of %d", auditLimit, len(lines))
+		lines = lines[:auditLimit]
+	}
+	return fmt.Sprintf(auditFormat, strings.ToLower(string(period)), more, strings.Join(lines, "\n"))
+}
+
+// describeAudit One line of the audit command, e.g. "18 Oct 14:05 <@U1> *revoke* <link>: 3 :taco: → 0 (duplicate)"
+func describeAudit(cfg *Config, event auditEvent) string {
+	change := ""
+	if event.Before != "" || event.After != "" {
+		change = fmt.Sprintf(": %s → %s", orNone(event.Before), orNone(event.After))
+	}
+	reason := ""
+	if event.Reason != "" {
+		reason = fmt.Sprintf(" (%s)", event.Reason)
+	}
+	return fmt.Sprintf(auditLineFormat, event.Time.In(cfg.location).Format(homeGiftDateFormat), event.Actor, event.Action, event.Target, change, reason)
+}
+
+// orNone The value or a dash when it is empty
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,77 @@
+package p
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// fakeSheets Serve the Google Sheets API with the handler until the test ends
+func fakeSheets(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	fake, err := sheets.New(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.BasePath = server.URL + "/"
+	serviceOnce.Do(func() {})
+	previous := service
+	service = fake
+	t.Cleanup(func() { service = previous })
+}
+
+// serveValues Answer every values read with the rows
+func serveValues(t *testing.T, rows [][]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"values": rows}); err != nil {
+			t.Errorf("Unable to encode values with error %v", err)
+		}
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	cfg := testConfig()
+	cfg.location = time.UTC
+	now := cfg.now()
+	fakeSheets(t, serveValues(t, [][]interface{}{
+		{now.AddDate(-2, 0, 0).Format(time.RFC3339), "T1", "<@U1>", "grant", "<@U2>", "", "1 :taco:", "old"},
+		{now.Format(time.RFC3339), "T1", "<@U1>", "revoke", "link", "1 :taco:", "revoked", "duplicate"},
+		{now.Format(time.RFC3339), "T2", "<@U3>", "ban", "<@U4>", "", "", ""},
+		{now.Format(time.RFC3339), "", settingsActor, "settings", "version abc", "MAX_EVERYDAY=5", "MAX_EVERYDAY=10", ""},
+	}))
+	tm := &team{ID: "T1", Config: cfg}
+
+	day := adminAudit(tm, nil, "C1", []string{"day"})
+	for _, want := range []string{"Audit events this day", "*revoke* link: 1 :taco: → revoked (duplicate)", "*settings* version abc: MAX_EVERYDAY=5 → MAX_EVERYDAY=10"} {
+		if !strings.Contains(day, want) {
+			t.Errorf("adminAudit(day) = %q, want it to contain %q", day, want)
+		}
+	}
+	for _, unwanted := range []string{"*grant*", "*ban*"} {
+		if strings.Contains(day, unwanted) {
+			t.Errorf("adminAudit(day) = %q, want no %q", day, unwanted)
+		}
+	}
+	if got := adminAudit(tm, nil, "C1", nil); got != day {
+		t.Errorf("adminAudit() = %q, want the day as with adminAudit(day)", got)
+	}
+	if got := adminAudit(tm, nil, "C1", []string{"decade"}); got != adminUsageMessage {
+		t.Errorf("adminAudit(decade) = %q, want the usage", got)
+	}
+}
+
+func TestAdminAuditEmpty(t *testing.T) {
+	cfg := testConfig()
+	cfg.location = time.UTC
+	fakeSheets(t, serveValues(t, nil))
+	if got, want := adminAudit(&team{ID: "T1", Config: cfg}, nil, "C1", []string{"week"}), "No audit event this week."; got != want {
+		t.Errorf("adminAudit(week) = %q, want %q", got, want)
+	}
+}
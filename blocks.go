@@ -0,0 +1,275 @@
+package p
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// block A Block Kit layout block, only the fields used by this app
+type block struct {
+	Type      string        `json:"type"`
+	BlockID   string        `json:"block_id,omitempty"`
+	Text      *textObject   `json:"text,omitempty"`
+	Elements  []interface{} `json:"elements,omitempty"`
+	Accessory interface{}   `json:"accessory,omitempty"`
+	Label     *textObject   `json:"label,omitempty"`
+	Element   interface{}   `json:"element,omitempty"`
+	Optional  bool          `json:"optional,omitempty"`
+}
+
+// textObject A Block Kit plain_text or mrkdwn text object
+type textObject struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+// buttonElement A Block Kit button element
+type buttonElement struct {
+	Type     string      `json:"type"`
+	Text     *textObject `json:"text"`
+	ActionID string      `json:"action_id"`
+	Value    string      `json:"value,omitempty"`
+	Style    string      `json:"style,omitempty"`
+}
+
+// imageElement A Block Kit image element
+type imageElement struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+const leaderboardTitle = "Leaderboard"
+const periodFormat = "%s from *%v* to *%v*"
+const rankFormat = "`%d.` %s"
+const footerFormat = "<%s|See all records in Google Sheets>"
+const pageFormat = "Page %d of %d"
+const previousPageText = "Previous page"
+const nextPageText = "Next page"
+
+// maxChartSections Slack rejects messages with more than 50 blocks, keep room for header, footer and buttons
+const maxChartSections = 40
+
+// medals Medal emoji of the first ranks
+var medals = []string{":crown:", ":rocket:", ":trident:"}
+
+// plainText Create a plain_text text object
+func plainText(text string) *textObject {
+	return &textObject{Type: "plain_text", Text: text, Emoji: true}
+}
+
+// markdown Create a mrkdwn text object
+func markdown(text string) *textObject {
+	return &textObject{Type: "mrkdwn", Text: text}
+}
+
+// pageCount Number of chart pages needed for the records
+func pageCount(cfg *Config, records ChartRecords) int {
+	count := (len(records) + cfg.ChartPageSize - 1) / cfg.ChartPageSize
+	if count == 0 {
+		return 1
+	}
+	return count
+}
+
+// pageBounds Return the first and past the last index of the records on the page
+func pageBounds(cfg *Config, records ChartRecords, page int) (int, int) {
+	start := page * cfg.ChartPageSize
+	if start > len(records) {
+		start = len(records)
+	}
+	end := start + cfg.ChartPageSize
+	if end > len(records) {
+		end = len(records)
+	}
+	return start, end
+}
+
+// chartText Render the page of chart records as plain text for notifications
+func chartText(cfg *Config, from Date, to Date, records ChartRecords, page int) string {
+	start, end := pageBounds(cfg, records, page)
+	var lines []string
+	for i := start; i < end; i++ {
+		lines = append(lines, records.line(i))
+	}
+	return fmt.Sprintf(resultMessageFormat, from, to, strings.Join(lines, "\n"))
+}
+
+// chartBlocks Render a page of chart records as Block Kit blocks with page and period buttons.
+// avatars maps real names to image URLs, receivers without avatar have none.
+func chartBlocks(cfg *Config, from Date, to Date, query chartQuery, records ChartRecords, avatars map[string]string, page int) []block {
+	blocks := []block{
+		{Type: "header", Text: plainText(leaderboardTitle)},
+		{Type: "context", Elements: []interface{}{markdown(fmt.Sprintf(periodFormat, query.describe(cfg), from, to))}},
+		{Type: "divider"},
+	}
+	start, end := pageBounds(cfg, records, page)
+	for i := start; i < end; i++ {
+		record := records[i]
+		section := block{Type: "section", Text: markdown(fmt.Sprintf(rankFormat, i+1, records.line(i)))}
+		if avatar, ok := avatars[record.Key]; ok && avatar != "" {
+			section.Accessory = imageElement{Type: "image", ImageURL: avatar, AltText: record.Key}
+		}
+		blocks = append(blocks, section)
+	}
+	if len(records) == 0 {
+		blocks = append(blocks, block{Type: "section", Text: markdown(noRecordMessage)})
+	}
+	if pages := pageCount(cfg, records); pages > 1 {
+		blocks = append(blocks, block{Type: "context", Elements: []interface{}{markdown(fmt.Sprintf(pageFormat, page+1, pages))}})
+	}
+	blocks = append(blocks, chartButtons(query, page, pageCount(cfg, records)))
+	if cfg.SpreadsheetURL != "" {
+		blocks = append(blocks,
+			block{Type: "divider"},
+			block{Type: "context", Elements: []interface{}{markdown(fmt.Sprintf(footerFormat, cfg.SpreadsheetURL))}},
+		)
+	}
+	return blocks
+}
+
+// chartButtons Render page buttons and one button per period.
+// Action ids must be unique within the block so they are suffixed.
+func chartButtons(query chartQuery, page int, pages int) block {
+	var elements []interface{}
+	if page > 0 {
+		elements = append(elements, chartButton(chartPageActionID+"_previous", previousPageText, query, page-1, ""))
+	}
+	if page+1 < pages {
+		elements = append(elements, chartButton(chartPageActionID+"_next", nextPageText, query, page+1, ""))
+	}
+	for _, duration := range durations {
+		periodQuery := query
+		periodQuery.Duration = duration
+		style := ""
+		if duration == query.Duration {
+			style = "primary"
+		}
+		elements = append(elements, chartButton(chartPeriodActionID+"_"+strings.ToLower(string(duration)), string(duration), periodQuery, 0, style))
+	}
+	return block{Type: "actions", Elements: elements}
+}
+
+// chartButton Render a button that switches the chart to the query and page
+func chartButton(actionID string, text string, query chartQuery, page int, style string) buttonElement {
+	value, err := json.Marshal(chartState{Query: query.String(), Page: page})
+	if err != nil {
+		log.Printf("Unable to marshal chart state with error %v\n", err)
+	}
+	return buttonElement{Type: "button", Text: plainText(text), ActionID: actionID, Value: string(value), Style: style}
+}
+
+// String Render the chart query as the chart command it was parsed from
+func (q chartQuery) String() string {
+	parts := []string{Chart, strings.ToLower(string(q.Duration))}
+	if q.Score {
+		parts = append(parts, "score")
+	}
+	if q.Currency != "" {
+		parts = append(parts, q.Currency)
+	}
+	if q.Tag != "" {
+		parts = append(parts, "#"+q.Tag)
+	}
+	for _, source := range q.Sources {
+		parts = append(parts, string(source))
+	}
+	for _, source := range q.ExcludedSources {
+		parts = append(parts, "-"+string(source))
+	}
+	return strings.Join(parts, " ")
+}
+
+// describe Describe the chart query for humans, e.g. "Week :rocket: #teamwork"
+func (q chartQuery) describe(cfg *Config) string {
+	parts := []string{string(q.Duration)}
+	switch {
+	case q.Score:
+		parts = append(parts, "score")
+	case q.Currency != "":
+		parts = append(parts, fmt.Sprintf(":%s:", q.Currency))
+	default:
+		parts = append(parts, cfg.defaultCurrency().Emoji())
+	}
+	if q.Tag != "" {
+		parts = append(parts, "#"+q.Tag)
+	}
+	for _, source := range q.Sources {
+		parts = append(parts, string(source))
+	}
+	for _, source := range q.ExcludedSources {
+		parts = append(parts, "-"+string(source))
+	}
+	return strings.Join(parts, " ")
+}
+
+// avatarsTTL How long the avatars of a workspace are reused before its members are listed again
+const avatarsTTL = time.Hour
+
+// avatarCache Avatars by team id, listing every member is slow and rate limited
+var avatarCache = struct {
+	sync.Mutex
+	byTeam map[string]teamAvatars
+}{byTeam: map[string]teamAvatars{}}
+
+// teamAvatars Avatars of a workspace by real name and when they were listed
+type teamAvatars struct {
+	byName map[string]string
+	listed time.Time
+}
+
+// getAvatars Map real names of every workspace member to their avatar URL, listed at most once per avatarsTTL
+func getAvatars(t *team) map[string]string {
+	avatarCache.Lock()
+	cached, ok := avatarCache.byTeam[t.ID]
+	avatarCache.Unlock()
+	if ok && time.Since(cached.listed) < avatarsTTL {
+		return cached.byName
+	}
+	byName := map[string]string{}
+	users, err := t.client.GetUsers()
+	if err != nil {
+		log.Printf("Unable to get users for avatars with error %v\n", err)
+		if ok {
+			return cached.byName
+		}
+		return byName
+	}
+	for _, user := range users {
+		byName[user.Profile.RealName] = user.Profile.Image48
+	}
+	avatarCache.Lock()
+	avatarCache.byTeam[t.ID] = teamAvatars{byName: byName, listed: time.Now()}
+	avatarCache.Unlock()
+	return byName
+}
+
+// msgOptionBlocks Send Block Kit blocks with the message, the library does not support them yet
+func msgOptionBlocks(endpoint string, blocks []block) slack.MsgOption {
+	return slack.UnsafeMsgOptionEndpoint(slack.APIURL+endpoint, func(values url.Values) {
+		encoded, err := json.Marshal(blocks)
+		if err != nil {
+			log.Printf("Unable to marshal blocks with error %v\n", err)
+			return
+		}
+		values.Set("blocks", string(encoded))
+	})
+}
+
+// postBlocks Post Block Kit message to Slack, text is the fallback for notifications
+func postBlocks(t *team, channel string, text string, blocks []block) {
+	respChannel, respTimestamp, err := t.client.PostMessage(channel, slack.MsgOptionText(text, false), msgOptionBlocks("chat.postMessage", blocks))
+	if err != nil {
+		log.Printf("Unable to post blocks to Slack with error %v\n", err)
+		return
+	}
+	log.Printf("Blocks posted to channel %v at %v\n", respChannel, respTimestamp)
+}
@@ -0,0 +1,70 @@
+package p
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// update Rewrite the golden files with the current output, e.g. go test -run TestChartBlocks -update
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden Compare the value rendered as indented JSON with testdata/<name>.golden
+func assertGolden(t *testing.T, name string, value interface{}) {
+	t.Helper()
+	got, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		t.Fatalf("Unable to marshal %v: %v", name, err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("Unable to update %v: %v", path, err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read %v, run with -update to create it: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%v differs from %v:\n%s", name, path, got)
+	}
+}
+
+func TestChartBlocks(t *testing.T) {
+	from := Date{2019, time.January, 14}
+	to := Date{2019, time.January, 18}
+	records := ChartRecords{{"Jane Doe", 9}, {"John Smith", 7}, {"Anna Nguyen", 4}, {"Minh Tran", 2}, {"Zoltan Kiss", 1}}
+	avatars := map[string]string{
+		"Jane Doe":   "https://avatars.example.com/jane.png",
+		"John Smith": "",
+		"Minh Tran":  "https://avatars.example.com/minh.png",
+	}
+	tests := []struct {
+		name     string
+		query    chartQuery
+		records  ChartRecords
+		page     int
+		pageSize int
+		url      string
+	}{
+		{"chart_empty", chartQuery{Duration: Day}, nil, 0, 10, ""},
+		{"chart_single_page", chartQuery{Duration: Week}, records, 0, 10, "https://docs.google.com/spreadsheets/d/sheet"},
+		{"chart_first_page", chartQuery{Duration: Sprint, Currency: "rocket"}, records, 0, 2, ""},
+		{"chart_middle_page", chartQuery{Duration: Month, Score: true, Tag: "teamwork"}, records, 1, 2, ""},
+		{"chart_last_page", chartQuery{Duration: Year, ExcludedSources: []Source{KarmaSource}}, records, 2, 2, "https://docs.google.com/spreadsheets/d/sheet"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ChartPageSize = test.pageSize
+			cfg.SpreadsheetURL = test.url
+			assertGolden(t, test.name, chartBlocks(cfg, from, to, test.query, test.records, avatars, test.page))
+		})
+	}
+}
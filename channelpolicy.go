@@ -0,0 +1,66 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Channel types of message events
+const (
+	publicChannelType  = "channel"
+	privateChannelType = "group"
+	directMessageType  = "im"
+	groupMessageType   = "mpim"
+)
+
+// channelPolicyFeedback Explain why gifts in the channel do not count, empty when they do
+func (cfg *Config) channelPolicyFeedback(channel string, channelType string) string {
+	values := map[string]string{"channel": fmt.Sprintf("<#%s>", channel)}
+	switch {
+	case !cfg.AllowDirectMessages && (channelType == directMessageType || channelType == groupMessageType):
+		return renderFeedback(cfg.Feedback.DirectMessage, values)
+	case !cfg.AllowPrivateChannels && channelType == privateChannelType:
+		return renderFeedback(cfg.Feedback.PrivateChannel, values)
+	case containsString(cfg.ExcludedChannels, channel):
+		return renderFeedback(cfg.Feedback.ChannelExcluded, values)
+	case len(cfg.AllowedChannels) > 0 && !containsString(cfg.AllowedChannels, channel) && channelType != directMessageType && channelType != groupMessageType:
+		return renderFeedback(cfg.Feedback.ChannelExcluded, values)
+	}
+	return ""
+}
+
+// channelTypeOf Type of the channel as in message events, for gifts that do not come from one, e.g. the give modal.
+// Installations without the read scopes fall back on the id prefix, D for direct messages and G for private channels.
+func channelTypeOf(t *team, channel string) string {
+	info, err := t.client.GetConversationInfo(channel, false)
+	if err == nil {
+		switch {
+		case info.IsIM:
+			return directMessageType
+		case info.IsMpIM:
+			return groupMessageType
+		case info.IsPrivate || info.IsGroup:
+			return privateChannelType
+		}
+		return publicChannelType
+	}
+	log.Printf("Unable to get channel %v info with error %v\n", channel, err)
+	switch {
+	case strings.HasPrefix(channel, "D"):
+		return directMessageType
+	case strings.HasPrefix(channel, "G"):
+		return privateChannelType
+	}
+	return publicChannelType
+}
+
+// containsGift Whether the text gives anything, so ignored messages are only explained when they matter
+func containsGift(cfg *Config, text string) bool {
+	for _, line := range parseMessage(cfg, text) {
+		if (len(line.Emoji) > 0 || len(line.Karma) > 0) && (len(line.Receivers) > 0 || len(line.UserGroups) > 0) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,315 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// channelsSheet Sheet storing channel profiles, one row per channel:
+// Team, Channel, Enabled, Weight, Day limit, Currency, Acknowledgment, Greeting
+const channelsSheet = "Channels"
+
+// channelsColumns Number of columns of a channel profile row
+const channelsColumns = 8
+
+// channelProfilesTTL How long the channel profiles of a workspace are reused, edits made in the sheet apply after it
+const channelProfilesTTL = time.Minute
+
+const configChannelUsageMessage = "Usage: ```config channel [#channel]\n" +
+	"config channel [#channel] enabled on|off\n" +
+	"config channel [#channel] weight <number>\n" +
+	"config channel [#channel] limit <number>|default\n" +
+	"config channel [#channel] currency <name>|any\n" +
+	"config channel [#channel] ack reactions|thread|ephemeral|none|default\n" +
+	"config channel [#channel] greeting <text>|default\n" +
+	"config channel [#channel] reset```"
+const channelProfileFormat = "Profile of <#%s>:\nGifts: *%s*\nWeight: *%d*\nDaily limit: *%s*\nCurrency: *%s*\nAcknowledgment: *%s*\nGreeting: %s"
+const adminOnlyMessage = "Only admins can do that."
+const defaultText = "default"
+
+// channelMentionPattern Channel mention of a slash command text, e.g. <#C123|general>
+var channelMentionPattern = regexp.MustCompile(`^<#(\w+)(?:\|[^>]*)?>$`)
+
+// channelProfile Rules overriding the global ones in a channel.
+// Zero values keep the global rule so a channel without a profile behaves as before.
+type channelProfile struct {
+	Team     string
+	Channel  string
+	Disabled bool
+	// Weight Multiplier of gifts in charts, e.g. 2 for double weight
+	Weight int
+	// DayLimit Daily limit of each currency, 0 for the currency limit
+	DayLimit int
+	// Currency Only currency accepted, empty for every currency
+	Currency string
+	// Ack Acknowledgment style, empty for the default one
+	Ack AckStyle
+	// Greeting Message replying to help, empty for the default one
+	Greeting string
+}
+
+// weight Multiplier of gifts in the channel
+func (p channelProfile) weight() int {
+	if p.Weight < 1 {
+		return 1
+	}
+	return p.Weight
+}
+
+// dayLimit Daily limit of the currency in the channel
+func (p channelProfile) dayLimit(c currency) int {
+	if p.DayLimit > 0 {
+		return p.DayLimit
+	}
+	return c.DayLimit
+}
+
+// accepts Whether gifts of the currency are accepted in the channel
+func (p channelProfile) accepts(currencyName string) bool {
+	return p.Currency == "" || p.Currency == currencyName
+}
+
+// greeting Message replying to help in the channel
+func (p channelProfile) greeting(cfg *Config) string {
+	if p.Greeting != "" {
+		return p.Greeting
+	}
+	return cfg.Greeting
+}
+
+// channelProfiles Channel profiles by team id, every gift reads the profile of its channel
+var channelProfiles = struct {
+	sync.Mutex
+	byTeam map[string]teamChannelProfiles
+}{byTeam: map[string]teamChannelProfiles{}}
+
+// teamChannelProfiles Channel profiles of a workspace by channel id and when they were read
+type teamChannelProfiles struct {
+	byChannel map[string]channelProfile
+	read      time.Time
+}
+
+// readChannelProfiles Read every channel profile of the workspace by channel id with its sheet row number
+func readChannelProfiles(t *team) (map[string]channelProfile, map[string]int, error) {
+	result := map[string]channelProfile{}
+	rowNumbers := map[string]int{}
+	response, err := sheetsService().Spreadsheets.Values.Get(t.Config.SpreadsheetID, channelsSheet+"!A2:H").Do()
+	if err != nil {
+		return result, rowNumbers, err
+	}
+	for i, row := range response.Values {
+		cells := make([]string, channelsColumns)
+		for j := 0; j < len(row) && j < channelsColumns; j++ {
+			cells[j] = fmt.Sprintf("%v", row[j])
+		}
+		if cells[0] != t.ID || cells[1] == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(cells[2])
+		if err != nil {
+			enabled = true
+		}
+		weight, _ := strconv.Atoi(cells[3])
+		limit, _ := strconv.Atoi(cells[4])
+		result[cells[1]] = channelProfile{
+			Team:     cells[0],
+			Channel:  cells[1],
+			Disabled: !enabled,
+			Weight:   weight,
+			DayLimit: limit,
+			Currency: cells[5],
+			Ack:      ackStyleOr(cells[6], ""),
+			Greeting: cells[7],
+		}
+		rowNumbers[cells[1]] = i + 2
+	}
+	return result, rowNumbers, nil
+}
+
+// channelProfileOf Profile of the channel, the zero profile when none is saved or the profiles can not be read.
+// The profiles of the workspace are read at most once per channelProfilesTTL.
+func channelProfileOf(t *team, channel string) channelProfile {
+	channelProfiles.Lock()
+	cached, ok := channelProfiles.byTeam[t.ID]
+	channelProfiles.Unlock()
+	if !ok || time.Since(cached.read) >= channelProfilesTTL {
+		profiles, _, err := readChannelProfiles(t)
+		if err != nil {
+			log.Printf("Unable to read channel profiles with error %v\n", err)
+		} else {
+			cached = teamChannelProfiles{byChannel: profiles, read: time.Now()}
+			channelProfiles.Lock()
+			channelProfiles.byTeam[t.ID] = cached
+			channelProfiles.Unlock()
+		}
+	}
+	if profile, ok := cached.byChannel[channel]; ok {
+		return profile
+	}
+	return channelProfile{Team: t.ID, Channel: channel}
+}
+
+// saveChannelProfile Update the row of the channel or append one, the next read sees the change
+func saveChannelProfile(t *team, p channelProfile) error {
+	_, rowNumbers, err := readChannelProfiles(t)
+	if err != nil {
+		// Appending could duplicate the row of the channel
+		return err
+	}
+	defer func() {
+		channelProfiles.Lock()
+		delete(channelProfiles.byTeam, t.ID)
+		channelProfiles.Unlock()
+	}()
+	var valueRange sheets.ValueRange
+	valueRange.Values = append(valueRange.Values, []interface{}{t.ID, p.Channel, !p.Disabled, p.Weight, p.DayLimit, p.Currency, string(p.Ack), p.Greeting})
+	if rowNumber, ok := rowNumbers[p.Channel]; ok {
+		_, err := sheetsService().Spreadsheets.Values.Update(t.Config.SpreadsheetID, fmt.Sprintf("%s!A%d", channelsSheet, rowNumber), &valueRange).ValueInputOption("RAW").Do()
+		return err
+	}
+	_, err = sheetsService().Spreadsheets.Values.Append(t.Config.SpreadsheetID, channelsSheet+"!A2", &valueRange).ValueInputOption("RAW").Do()
+	return err
+}
+
+// handleConfigChannel Show or change the profile of the channel, args follow the config channel words.
+// The channel is the one the command is run in unless a channel is mentioned first.
+func handleConfigChannel(t *team, userID string, channel string, args []string) string {
+	if !isAdmin(t, userID) {
+		return adminOnlyMessage
+	}
+	if len(args) > 0 {
+		if match := channelMentionPattern.FindStringSubmatch(args[0]); match != nil {
+			channel = match[1]
+			args = args[1:]
+		}
+	}
+	p := channelProfileOf(t, channel)
+	before := p
+	if len(args) == 0 {
+		return formatChannelProfile(p)
+	}
+	key := strings.ToLower(args[0])
+	value := strings.Join(args[1:], " ")
+	if key == "reset" {
+		p = channelProfile{Team: t.ID, Channel: channel}
+	} else {
+		if value == "" {
+			return configChannelUsageMessage
+		}
+		var ok bool
+		if p, ok = setChannelProfile(t.Config, p, key, value); !ok {
+			return configChannelUsageMessage
+		}
+	}
+	if err := saveChannelProfile(t, p); err != nil {
+		log.Printf("Unable to save channel profile %+v with error %v\n", p, err)
+		return fmt.Sprintf("Unable to save the channel profile: %v", err)
+	}
+	log.Printf("Channel profile saved %+v by user %v\n", p, userID)
+	event := auditEvent{Team: t.ID, Actor: fmt.Sprintf("<@%s>", userID), Action: "config channel", Target: fmt.Sprintf("<#%s>", channel), Before: summarizeChannelProfile(before), After: summarizeChannelProfile(p)}
+	background(func() { recordAudit(t.Config, event) })
+	return settingsSavedMessage + formatChannelProfile(p)
+}
+
+// setChannelProfile Change one rule of the profile, false when the key or the value is not supported
+func setChannelProfile(cfg *Config, p channelProfile, key string, value string) (channelProfile, bool) {
+	lower := strings.ToLower(value)
+	switch key {
+	case "enabled":
+		on, ok := map[string]bool{"on": true, "off": false}[lower]
+		if !ok {
+			return p, false
+		}
+		p.Disabled = !on
+	case "weight":
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 1 {
+			return p, false
+		}
+		p.Weight = weight
+	case "limit":
+		if lower == defaultText {
+			p.DayLimit = 0
+			break
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return p, false
+		}
+		p.DayLimit = limit
+	case "currency":
+		if lower == "any" {
+			p.Currency = ""
+			break
+		}
+		c, ok := cfg.currencyNamed(lower)
+		if !ok {
+			return p, false
+		}
+		p.Currency = c.Name
+	case "ack":
+		if lower == defaultText {
+			p.Ack = ""
+			break
+		}
+		style := ackStyleOr(lower, "")
+		if style == "" {
+			return p, false
+		}
+		p.Ack = style
+	case "greeting":
+		if lower == defaultText {
+			p.Greeting = ""
+			break
+		}
+		p.Greeting = value
+	default:
+		return p, false
+	}
+	return p, true
+}
+
+// summarizeChannelProfile The rules of the profile on one line for the audit sheet, e.g. enabled=on weight=2 limit=5
+func summarizeChannelProfile(p channelProfile) string {
+	rules := []string{fmt.Sprintf("enabled=%s", map[bool]string{true: "off", false: "on"}[p.Disabled]), fmt.Sprintf("weight=%d", p.weight())}
+	if p.DayLimit > 0 {
+		rules = append(rules, fmt.Sprintf("limit=%d", p.DayLimit))
+	}
+	if p.Currency != "" {
+		rules = append(rules, "currency="+p.Currency)
+	}
+	if p.Ack != "" {
+		rules = append(rules, "ack="+string(p.Ack))
+	}
+	if p.Greeting != "" {
+		rules = append(rules, fmt.Sprintf("greeting=%q", p.Greeting))
+	}
+	return strings.Join(rules, " ")
+}
+
+// formatChannelProfile Render the profile for the config channel command
+func formatChannelProfile(p channelProfile) string {
+	onOff := map[bool]string{true: "off", false: "on"}
+	orDefault := func(value string) string {
+		if value == "" {
+			return defaultText
+		}
+		return value
+	}
+	limit := defaultText
+	if p.DayLimit > 0 {
+		limit = strconv.Itoa(p.DayLimit)
+	}
+	currency := p.Currency
+	if currency == "" {
+		currency = "any"
+	}
+	return fmt.Sprintf(channelProfileFormat, p.Channel, onOff[p.Disabled], p.weight(), limit, currency, orDefault(string(p.Ack)), orDefault(p.Greeting))
+}
@@ -0,0 +1,68 @@
+// Command server hosts the bot as a standalone HTTP server, e.g. on Cloud Run, a VM or locally.
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	p "cloudfunction"
+)
+
+// shutdownTimeout How long in-flight requests and background jobs are given to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+func main() {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		log.Fatalf("Invalid PORT %v", port)
+	}
+	server := &http.Server{Addr: ":" + port, Handler: routes()}
+
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Println("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Unable to shut down the server with error %v\n", err)
+		}
+		if err := p.Drain(ctx); err != nil {
+			log.Printf("Background jobs not drained with error %v\n", err)
+		}
+		close(stopped)
+	}()
+
+	log.Printf("Listening on port %v\n", port)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("Server stopped with error %v", err)
+	}
+	<-stopped
+}
+
+// routes Route table of the server
+func routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/events", p.HandleEvents)
+	mux.HandleFunc("/slack/commands", p.HandleCommands)
+	mux.HandleFunc("/slack/interactions", p.HandleInteractions)
+	mux.HandleFunc("/slack/install", p.HandleInstall)
+	mux.HandleFunc("/slack/oauth_redirect", p.HandleOAuthRedirect)
+	mux.HandleFunc("/cron/", p.HandleCron)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
@@ -0,0 +1,38 @@
+// Command socketmode runs the bot over Socket Mode, without a public URL.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	p "cloudfunction"
+)
+
+// drainTimeout How long background jobs are given to finish on shutdown
+const drainTimeout = 30 * time.Second
+
+func main() {
+	appToken := os.Getenv("SLACK_APP_TOKEN")
+	if appToken == "" {
+		log.Fatal("SLACK_APP_TOKEN is not configured")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	if err := p.NewSocketMode(appToken).Run(ctx); err != nil && err != context.Canceled {
+		log.Fatalf("Socket Mode stopped with error %v", err)
+	}
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer drainCancel()
+	if err := p.Drain(drainCtx); err != nil {
+		log.Printf("Background jobs not drained with error %v\n", err)
+	}
+}
@@ -0,0 +1,124 @@
+package p
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SubCommand First word of a slash command text, e.g. give in /taco give
+type SubCommand string
+
+const (
+	// Give Open the give modal
+	Give SubCommand = "give"
+	// Settings Show or change notification preferences
+	Settings SubCommand = "settings"
+	// Configure Show or change configuration, admins only
+	Configure SubCommand = "config"
+	// Admin Fix mistakes and manage the app, by role
+	Admin SubCommand = "admin"
+)
+
+const notInstalledMessage = "The app is not installed in this workspace."
+const commandUsageMessage = "Available commands are: ```give\nsettings\nconfig channel\nadmin```"
+
+// slashCommand Slash command request, parsed from the form over HTTP or from the JSON payload over Socket Mode
+type slashCommand struct {
+	Command   string `json:"command"`
+	Text      string `json:"text"`
+	TeamID    string `json:"team_id"`
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+	TriggerID string `json:"trigger_id"`
+	// ResponseURL Where to respond later, Socket Mode acknowledges commands before they are handled
+	ResponseURL string `json:"response_url"`
+}
+
+// isCommand Whether the form encoded body is a slash command rather than an interactivity payload
+func isCommand(body string) bool {
+	values, err := url.ParseQuery(body)
+	return err == nil && values.Get("command") != ""
+}
+
+// parseCommand Verify and handle a form encoded slash command request from Slack
+func parseCommand(cfg *Config, header http.Header, body string, w http.ResponseWriter) bool {
+	if err := verifyRequest(cfg, header, body); err != nil {
+		log.Printf("Unable to verify command signature with error %v\n", err)
+		return false
+	}
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		log.Printf("Unable to parse command form with error %v\n", err)
+		return false
+	}
+	command := slashCommand{
+		Command:     values.Get("command"),
+		Text:        values.Get("text"),
+		TeamID:      values.Get("team_id"),
+		ChannelID:   values.Get("channel_id"),
+		UserID:      values.Get("user_id"),
+		TriggerID:   values.Get("trigger_id"),
+		ResponseURL: values.Get("response_url"),
+	}
+	log.Printf("Command: %+v\n", command)
+	response := handleCommand(cfg, command)
+	if response != "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte(response)); err != nil {
+			log.Printf("Unable to write command response with error %v\n", err)
+		}
+	}
+	return true
+}
+
+// handleCommand Handle the slash command and return the ephemeral response text, if any
+func handleCommand(cfg *Config, command slashCommand) string {
+	t := teamFor(cfg, command.TeamID)
+	if t == nil {
+		return notInstalledMessage
+	}
+	// Only the sub command is lower cased since arguments may be channel ids or free text
+	fields := strings.Fields(command.Text)
+	if len(fields) == 0 {
+		return commandUsageMessage
+	}
+	switch SubCommand(strings.ToLower(fields[0])) {
+	case Give:
+		openGiveModal(t, command.TriggerID, command.UserID, command.ChannelID, giveModalPrefill{})
+		return ""
+	case Settings:
+		return handleSettings(t, command.UserID, fields[1:])
+	case Configure:
+		if len(fields) < 2 || strings.ToLower(fields[1]) != "channel" {
+			return configChannelUsageMessage
+		}
+		return handleConfigChannel(t, command.UserID, command.ChannelID, fields[2:])
+	case Admin:
+		return handleAdmin(t, command.UserID, command.ChannelID, fields[1:])
+	}
+	log.Printf("Strange command %v %v\n", command.Command, command.Text)
+	return commandUsageMessage
+}
+
+// respondTo Send the text to the user who ran the command through its response URL, visible only to them
+func respondTo(responseURL string, text string) {
+	body, err := json.Marshal(map[string]string{"response_type": "ephemeral", "text": text})
+	if err != nil {
+		log.Printf("Unable to marshal command response with error %v\n", err)
+		return
+	}
+	response, err := http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Unable to send command response with error %v\n", err)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		log.Printf("Unable to send command response, status %v\n", response.Status)
+	}
+}
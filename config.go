@@ -0,0 +1,542 @@
+package p
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// sprintDateFormat Layout of the sprint start date, dd MM yyyy
+const sprintDateFormat = "02 01 2006"
+
+const defaultLocation = "Vietnam"
+const defaultChartPageSize = 10
+const defaultSettingsPollInterval = "1m"
+const greetingFormat = "Chào anh chị em e-pilot :thuan: :mama-thuy: :tung: Xem BXH tại %s"
+
+// Config Configuration of the app, loaded from an optional JSON or YAML file then environment variables.
+// Environment variables override the file. Field comments name the environment variable.
+type Config struct {
+	// SlackToken SLACK_TOKEN, bot token of the workspace installed without OAuth
+	SlackToken string `json:"slack_token" yaml:"slack_token"`
+	// VerificationToken VERIFICATION_TOKEN
+	VerificationToken string `json:"verification_token" yaml:"verification_token"`
+	// SigningSecret SIGNING_SECRET, verifies interactivity and slash command requests
+	SigningSecret string `json:"signing_secret" yaml:"signing_secret"`
+	// ClientID SLACK_CLIENT_ID, OAuth install flow
+	ClientID string `json:"client_id" yaml:"client_id"`
+	// ClientSecret SLACK_CLIENT_SECRET, OAuth install flow
+	ClientSecret string `json:"client_secret" yaml:"client_secret"`
+	// RedirectURL SLACK_REDIRECT_URL, OAuth install flow
+	RedirectURL string `json:"redirect_url" yaml:"redirect_url"`
+	// CronSecret CRON_SECRET, bearer token of scheduled job requests
+	CronSecret string `json:"cron_secret" yaml:"cron_secret"`
+
+	// SpreadsheetID SPREADSHEET_ID
+	SpreadsheetID string `json:"spreadsheet_id" yaml:"spreadsheet_id"`
+	// SpreadsheetURL SPREADSHEET_URL, shareable link to the spreadsheet
+	SpreadsheetURL string `json:"spreadsheet_url" yaml:"spreadsheet_url"`
+
+	// EmojiName EMOJI_NAME, the currency when Currencies is empty
+	EmojiName string `json:"emoji_name" yaml:"emoji_name"`
+	// DayLimit MAX_EVERYDAY, default maximum number of emoji each user can give everyday
+	DayLimit int `json:"max_everyday" yaml:"max_everyday"`
+	// MaxPerGift MAX_PER_GIFT, maximum given to each receiver in a single gift, 0 for no limit
+	MaxPerGift int `json:"max_per_gift" yaml:"max_per_gift"`
+	// Currencies CURRENCIES, name:dayLimit:weight separated by commas, e.g. "taco:5:1,rocket:3:2"
+	Currencies string `json:"currencies" yaml:"currencies"`
+	// SplitPolicy SPLIT_POLICY, each or split
+	SplitPolicy SplitPolicy `json:"split_policy" yaml:"split_policy"`
+	// KarmaChannels KARMA_CHANNELS, channels where the karma syntax is recognised
+	KarmaChannels []string `json:"karma_channels" yaml:"karma_channels"`
+	// Values VALUES, company values gifts can be tagged with
+	Values []string `json:"values" yaml:"values"`
+
+	// Location LOCATION, country of countryTz or IANA time zone the days are counted in
+	Location string `json:"location" yaml:"location"`
+	// SprintStartDate SPRINT_START_DATE, start date of any sprint, dd MM yyyy
+	SprintStartDate string `json:"sprint_start_date" yaml:"sprint_start_date"`
+	// SprintDuration SPRINT_DURATION, sprint duration in days
+	SprintDuration int `json:"sprint_duration" yaml:"sprint_duration"`
+
+	// Greeting GREETING, reply to help
+	Greeting string `json:"greeting" yaml:"greeting"`
+	// ChartPageSize CHART_PAGE_SIZE, number of ranks on each chart page
+	ChartPageSize int `json:"chart_page_size" yaml:"chart_page_size"`
+	// RecognitionChannel RECOGNITION_CHANNEL, where recognitions from the give modal are posted
+	RecognitionChannel string `json:"recognition_channel" yaml:"recognition_channel"`
+	// AckStyle ACK_STYLE, acknowledgment style of channels without one
+	AckStyle AckStyle `json:"ack_style" yaml:"ack_style"`
+	// AckChannels ACK_CHANNELS, acknowledgment style by channel id, e.g. "C123:thread,C456:none"
+	AckChannels map[string]AckStyle `json:"ack_channels" yaml:"ack_channels"`
+	// FeedbackStyle FEEDBACK_STYLE, feedback style of channels without one
+	FeedbackStyle FeedbackStyle `json:"feedback_style" yaml:"feedback_style"`
+	// FeedbackChannels FEEDBACK_CHANNELS, feedback style by channel id, e.g. "C123:reactions"
+	FeedbackChannels map[string]FeedbackStyle `json:"feedback_channels" yaml:"feedback_channels"`
+	// Feedback FEEDBACK_*, feedback message templates
+	Feedback feedbackTemplates `json:"feedback" yaml:"feedback"`
+
+	// AllowedChannels ALLOWED_CHANNELS, only channels where gifts count, every channel when empty
+	AllowedChannels []string `json:"allowed_channels" yaml:"allowed_channels"`
+	// ExcludedChannels EXCLUDED_CHANNELS, channels where gifts do not count
+	ExcludedChannels []string `json:"excluded_channels" yaml:"excluded_channels"`
+	// AllowDirectMessages ALLOW_DIRECT_MESSAGES, whether gifts in direct and group messages count
+	AllowDirectMessages bool `json:"allow_direct_messages" yaml:"allow_direct_messages"`
+	// AllowPrivateChannels ALLOW_PRIVATE_CHANNELS, whether gifts in private channels count
+	AllowPrivateChannels bool `json:"allow_private_channels" yaml:"allow_private_channels"`
+	// AdminUsers ADMIN_USERS, user ids allowed to run every admin command
+	AdminUsers []string `json:"admin_users" yaml:"admin_users"`
+	// AdminGroup ADMIN_GROUP, id of the user group whose members are admins
+	AdminGroup string `json:"admin_group" yaml:"admin_group"`
+	// ModeratorUsers MODERATOR_USERS, user ids allowed to revoke gifts and reset limits
+	ModeratorUsers []string `json:"moderator_users" yaml:"moderator_users"`
+	// ModeratorGroup MODERATOR_GROUP, id of the user group whose members are moderators
+	ModeratorGroup string `json:"moderator_group" yaml:"moderator_group"`
+	// SettingsPollInterval SETTINGS_POLL_INTERVAL, how often the Settings sheet is read, e.g. 1m, 0 to ignore the sheet
+	SettingsPollInterval string `json:"settings_poll_interval" yaml:"settings_poll_interval"`
+
+	// currencies Parsed Currencies, the first one is the default
+	currencies []currency
+	// sprintStart Parsed SprintStartDate
+	sprintStart time.Time
+	// location Loaded Location
+	location *time.Location
+	// settingsPoll Parsed SettingsPollInterval
+	settingsPoll time.Duration
+	// version Version of the Settings sheet applied, empty when none
+	version string
+	// settings Settings of the sheet applied by name, to audit what the next version changes
+	settings map[string]string
+}
+
+// configErrors Every problem found in the configuration, reported at once
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// defaultConfig Configuration before the file and the environment are applied
+func defaultConfig() *Config {
+	return &Config{
+		Location:             defaultLocation,
+		ChartPageSize:        defaultChartPageSize,
+		SplitPolicy:          Each,
+		AckStyle:             ReactionsAck,
+		FeedbackStyle:        EphemeralFeedback,
+		Feedback:             defaultFeedbackTemplates,
+		AllowDirectMessages:  true,
+		AllowPrivateChannels: true,
+		SettingsPollInterval: defaultSettingsPollInterval,
+	}
+}
+
+// configState Configuration requests are handled with.
+// base is the configuration of the file and the environment, config also applies the Settings sheet.
+type configState struct {
+	sync.Mutex
+	// loaded Loads the configuration with the first request, the others wait for it without holding the mutex
+	loaded  sync.Once
+	base    *Config
+	config  *Config
+	checked time.Time
+	// refreshing Whether the Settings sheet is being read, requests keep the current configuration meanwhile
+	refreshing bool
+	// rejected Version of the Settings sheet found invalid, not loaded again until the sheet changes
+	rejected string
+}
+
+// activeConfig Configuration requests are handled with, loaded by the first request
+var activeConfig = &configState{}
+
+// currentConfig Configuration to handle a request with, read once at its entry and passed down.
+// The Settings sheet is read again in the background when it was last read more than the poll interval ago.
+func currentConfig() *Config {
+	activeConfig.loaded.Do(loadActiveConfig)
+	activeConfig.Lock()
+	defer activeConfig.Unlock()
+	poll := activeConfig.base.settingsPoll
+	if poll > 0 && !activeConfig.refreshing && time.Since(activeConfig.checked) >= poll {
+		activeConfig.checked = time.Now()
+		activeConfig.refreshing = true
+		base, current, rejected := activeConfig.base, activeConfig.config, activeConfig.rejected
+		background(func() { refreshConfig(base, current, rejected) })
+	}
+	return activeConfig.config
+}
+
+// loadActiveConfig Load the configuration and read the Settings sheet a first time.
+// Only the first requests wait for the sheet, so none runs with the environment alone.
+func loadActiveConfig() {
+	base := mustLoadConfig()
+	cfg, rejected, checked := base, "", time.Time{}
+	if base.settingsPoll > 0 {
+		checked = time.Now()
+		cfg, rejected = applySettings(base, base, "", true)
+	}
+	activeConfig.Lock()
+	defer activeConfig.Unlock()
+	activeConfig.base = base
+	activeConfig.config = cfg
+	activeConfig.rejected = rejected
+	activeConfig.checked = checked
+}
+
+// refreshConfig Read the Settings sheet without holding the configuration, then swap in the configuration it gives
+func refreshConfig(base *Config, current *Config, rejected string) {
+	cfg, rejected := applySettings(base, current, rejected, false)
+	activeConfig.Lock()
+	defer activeConfig.Unlock()
+	activeConfig.refreshing = false
+	activeConfig.rejected = rejected
+	activeConfig.config = cfg
+}
+
+// mustLoadConfig Load the configuration of CONFIG_FILE and the environment, stopping when it is invalid
+func mustLoadConfig() *Config {
+	cfg, err := LoadConfig(os.Getenv("CONFIG_FILE"), os.Getenv)
+	if err != nil {
+		log.Fatalf("Unable to load configuration. %v", err)
+	}
+	return cfg
+}
+
+// LoadConfig Load the configuration from the optional JSON or YAML file then the environment, and validate it
+func LoadConfig(path string, getenv func(string) string) (*Config, error) {
+	cfg := defaultConfig()
+	var errs configErrors
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	errs = append(errs, cfg.readEnv(getenv)...)
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	log.Printf("Currencies: %+v, company values: %v\n", cfg.currencies, cfg.Values)
+	return cfg, nil
+}
+
+// readFile Read the JSON or YAML file, by extension
+func (cfg *Config) readFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		// As strict as YAML, so a misspelled key is reported rather than ignored
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, cfg)
+	default:
+		return fmt.Errorf("CONFIG_FILE: %v is neither .json, .yaml nor .yml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: unable to parse %v: %v", path, err)
+	}
+	return nil
+}
+
+// readEnv Override the configuration with the environment variables that are set
+func (cfg *Config) readEnv(getenv func(string) string) configErrors {
+	var errs configErrors
+	str := func(name string, target *string) {
+		if value := getenv(name); value != "" {
+			*target = value
+		}
+	}
+	number := func(name string, target *int) {
+		if value := getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a number", name, value))
+				return
+			}
+			*target = n
+		}
+	}
+	boolean := func(name string, target *bool) {
+		if value := getenv(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not true or false", name, value))
+				return
+			}
+			*target = b
+		}
+	}
+	list := func(name string, target *[]string) {
+		if value := getenv(name); value != "" {
+			*target = splitList(value)
+		}
+	}
+	pairs := func(name string) map[string]string {
+		value := getenv(name)
+		if value == "" {
+			return nil
+		}
+		result, err := parseChannelPairs(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+		return result
+	}
+
+	str("SLACK_TOKEN", &cfg.SlackToken)
+	str("VERIFICATION_TOKEN", &cfg.VerificationToken)
+	str("SIGNING_SECRET", &cfg.SigningSecret)
+	str("SLACK_CLIENT_ID", &cfg.ClientID)
+	str("SLACK_CLIENT_SECRET", &cfg.ClientSecret)
+	str("SLACK_REDIRECT_URL", &cfg.RedirectURL)
+	str("CRON_SECRET", &cfg.CronSecret)
+	str("SPREADSHEET_ID", &cfg.SpreadsheetID)
+	str("SPREADSHEET_URL", &cfg.SpreadsheetURL)
+	str("EMOJI_NAME", &cfg.EmojiName)
+	number("MAX_EVERYDAY", &cfg.DayLimit)
+	number("MAX_PER_GIFT", &cfg.MaxPerGift)
+	str("CURRENCIES", &cfg.Currencies)
+	if value := getenv("SPLIT_POLICY"); value != "" {
+		cfg.SplitPolicy = SplitPolicy(value)
+	}
+	list("KARMA_CHANNELS", &cfg.KarmaChannels)
+	list("VALUES", &cfg.Values)
+	str("LOCATION", &cfg.Location)
+	str("SPRINT_START_DATE", &cfg.SprintStartDate)
+	number("SPRINT_DURATION", &cfg.SprintDuration)
+	str("GREETING", &cfg.Greeting)
+	number("CHART_PAGE_SIZE", &cfg.ChartPageSize)
+	str("RECOGNITION_CHANNEL", &cfg.RecognitionChannel)
+	if value := getenv("ACK_STYLE"); value != "" {
+		cfg.AckStyle = AckStyle(strings.ToLower(value))
+	}
+	if channels := pairs("ACK_CHANNELS"); channels != nil {
+		cfg.AckChannels = map[string]AckStyle{}
+		for channel, style := range channels {
+			cfg.AckChannels[channel] = AckStyle(strings.ToLower(style))
+		}
+	}
+	if value := getenv("FEEDBACK_STYLE"); value != "" {
+		cfg.FeedbackStyle = FeedbackStyle(strings.ToLower(value))
+	}
+	if channels := pairs("FEEDBACK_CHANNELS"); channels != nil {
+		cfg.FeedbackChannels = map[string]FeedbackStyle{}
+		for channel, style := range channels {
+			cfg.FeedbackChannels[channel] = FeedbackStyle(strings.ToLower(style))
+		}
+	}
+	str("FEEDBACK_SELF_GIVING", &cfg.Feedback.SelfGiving)
+	str("FEEDBACK_BOT_RECEIVER", &cfg.Feedback.BotReceiver)
+	str("FEEDBACK_LIMIT_REACHED", &cfg.Feedback.LimitReached)
+	str("FEEDBACK_TRIMMED", &cfg.Feedback.Trimmed)
+	str("FEEDBACK_DIRECT_MESSAGE", &cfg.Feedback.DirectMessage)
+	str("FEEDBACK_PRIVATE_CHANNEL", &cfg.Feedback.PrivateChannel)
+	str("FEEDBACK_CHANNEL_EXCLUDED", &cfg.Feedback.ChannelExcluded)
+	str("FEEDBACK_BANNED_GIVER", &cfg.Feedback.BannedGiver)
+	str("FEEDBACK_BANNED_RECEIVER", &cfg.Feedback.BannedReceiver)
+	list("ALLOWED_CHANNELS", &cfg.AllowedChannels)
+	list("EXCLUDED_CHANNELS", &cfg.ExcludedChannels)
+	boolean("ALLOW_DIRECT_MESSAGES", &cfg.AllowDirectMessages)
+	boolean("ALLOW_PRIVATE_CHANNELS", &cfg.AllowPrivateChannels)
+	list("ADMIN_USERS", &cfg.AdminUsers)
+	str("ADMIN_GROUP", &cfg.AdminGroup)
+	list("MODERATOR_USERS", &cfg.ModeratorUsers)
+	str("MODERATOR_GROUP", &cfg.ModeratorGroup)
+	str("SETTINGS_POLL_INTERVAL", &cfg.SettingsPollInterval)
+	return errs
+}
+
+// validate Check every setting, parsing the derived ones, and return every problem found
+func (cfg *Config) validate() configErrors {
+	var errs configErrors
+	if cfg.SpreadsheetID == "" {
+		errs = append(errs, "SPREADSHEET_ID is required")
+	}
+	if cfg.SlackToken == "" && (cfg.ClientID == "" || cfg.ClientSecret == "") {
+		errs = append(errs, "SLACK_TOKEN, or SLACK_CLIENT_ID and SLACK_CLIENT_SECRET to install with OAuth, is required")
+	}
+
+	currencies, currencyErrs := parseCurrencies(cfg.Currencies, cfg.EmojiName, cfg.DayLimit)
+	errs = append(errs, currencyErrs...)
+	cfg.currencies = currencies
+	if cfg.MaxPerGift < 0 {
+		errs = append(errs, fmt.Sprintf("MAX_PER_GIFT: %d is negative", cfg.MaxPerGift))
+	}
+	if cfg.SplitPolicy != Each && cfg.SplitPolicy != Split {
+		errs = append(errs, fmt.Sprintf("SPLIT_POLICY: %q is neither %s nor %s", cfg.SplitPolicy, Each, Split))
+	}
+	var values []string
+	for _, value := range cfg.Values {
+		if value = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "#")); value != "" {
+			values = append(values, value)
+		}
+	}
+	cfg.Values = values
+
+	location, err := loadLocation(cfg.Location)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("LOCATION: %q is neither one of %v nor a time zone", cfg.Location, countryNames()))
+	}
+	cfg.location = location
+	switch {
+	case cfg.SprintStartDate == "":
+		errs = append(errs, "SPRINT_START_DATE is required, e.g. 07 01 2019")
+	case location == nil:
+		// The date can not be placed without the location, which is already reported
+	default:
+		start, err := time.ParseInLocation(sprintDateFormat, cfg.SprintStartDate, location)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("SPRINT_START_DATE: %q is not dd MM yyyy, e.g. 07 01 2019", cfg.SprintStartDate))
+		}
+		cfg.sprintStart = start
+	}
+	if cfg.SprintDuration <= 0 {
+		errs = append(errs, "SPRINT_DURATION is required and must be a positive number of days")
+	}
+
+	if cfg.Greeting == "" {
+		cfg.Greeting = fmt.Sprintf(greetingFormat, cfg.SpreadsheetURL)
+	}
+	if poll, err := time.ParseDuration(cfg.SettingsPollInterval); err != nil || poll < 0 {
+		errs = append(errs, fmt.Sprintf("SETTINGS_POLL_INTERVAL: %q is not a duration, e.g. 1m", cfg.SettingsPollInterval))
+	} else {
+		cfg.settingsPoll = poll
+	}
+	if cfg.ChartPageSize <= 0 || cfg.ChartPageSize > maxChartSections {
+		errs = append(errs, fmt.Sprintf("CHART_PAGE_SIZE: %d is not between 1 and %d", cfg.ChartPageSize, maxChartSections))
+	}
+	if ackStyleOr(string(cfg.AckStyle), "") == "" {
+		errs = append(errs, fmt.Sprintf("ACK_STYLE: %q is not one of %v", cfg.AckStyle, ackStyles))
+	}
+	for channel, style := range cfg.AckChannels {
+		if ackStyleOr(string(style), "") == "" {
+			errs = append(errs, fmt.Sprintf("ACK_CHANNELS: %q of channel %v is not one of %v", style, channel, ackStyles))
+		}
+	}
+	if feedbackStyleOr(string(cfg.FeedbackStyle), "") == "" {
+		errs = append(errs, fmt.Sprintf("FEEDBACK_STYLE: %q is not one of %v", cfg.FeedbackStyle, feedbackStyles))
+	}
+	for channel, style := range cfg.FeedbackChannels {
+		if feedbackStyleOr(string(style), "") == "" {
+			errs = append(errs, fmt.Sprintf("FEEDBACK_CHANNELS: %q of channel %v is not one of %v", style, channel, feedbackStyles))
+		}
+	}
+	return errs
+}
+
+// parseCurrencies Parse currencies formatted as name:dayLimit:weight separated by commas,
+// falling back to the emoji name with the default day limit and weight 1
+func parseCurrencies(config string, emojiName string, dayLimit int) ([]currency, configErrors) {
+	var result []currency
+	var errs configErrors
+	for _, item := range splitList(config) {
+		parts := strings.Split(item, ":")
+		c := currency{Name: strings.TrimSpace(parts[0]), DayLimit: dayLimit, Weight: 1}
+		if c.Name == "" {
+			errs = append(errs, fmt.Sprintf("CURRENCIES: %q has no emoji name", item))
+			continue
+		}
+		if len(parts) > 1 {
+			limit, err := strconv.Atoi(parts[1])
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("CURRENCIES: day limit of %q is not a number", item))
+			}
+			c.DayLimit = limit
+		}
+		if len(parts) > 2 {
+			weight, err := strconv.Atoi(parts[2])
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("CURRENCIES: weight of %q is not a number", item))
+			}
+			c.Weight = weight
+		}
+		result = append(result, c)
+	}
+	if len(result) == 0 && config == "" && strings.Trim(emojiName, ":") != "" {
+		result = append(result, currency{Name: strings.Trim(emojiName, ":"), DayLimit: dayLimit, Weight: 1})
+	}
+	if len(result) == 0 {
+		if config == "" {
+			errs = append(errs, "EMOJI_NAME or CURRENCIES is required")
+		} else {
+			errs = append(errs, fmt.Sprintf("CURRENCIES: no currency in %q", config))
+		}
+	}
+	seen := map[string]bool{}
+	for _, c := range result {
+		if seen[c.Name] {
+			errs = append(errs, fmt.Sprintf("CURRENCIES: %v appears twice", c.Name))
+		}
+		seen[c.Name] = true
+		if c.DayLimit <= 0 {
+			errs = append(errs, fmt.Sprintf("MAX_EVERYDAY or the day limit of currency %v is required and must be positive", c.Name))
+		}
+	}
+	return result, errs
+}
+
+// splitList Split a comma separated list, skipping blanks
+func splitList(config string) []string {
+	var result []string
+	for _, item := range strings.Split(config, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// loadLocation Load the location of the country of countryTz or the IANA time zone
+func loadLocation(name string) (*time.Location, error) {
+	if tz, ok := countryTz[name]; ok {
+		return time.LoadLocation(tz)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no location")
+	}
+	return time.LoadLocation(name)
+}
+
+// countryNames Names of the supported countries
+func countryNames() []string {
+	var result []string
+	for name := range countryTz {
+		result = append(result, name)
+	}
+	return result
+}
+
+// now Current time in the configured location
+func (cfg *Config) now() time.Time {
+	return time.Now().In(cfg.location)
+}
+
+// currentSprintStart Start of the sprint containing now, counting whole sprints from the configured start date.
+// A start date in the future counts back so the sprint containing now is found either way.
+func (cfg *Config) currentSprintStart(now time.Time) time.Time {
+	// Count days between UTC midnights so daylight saving time does not shorten one
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	startYear, startMonth, startDay := cfg.sprintStart.Date()
+	start := time.Date(startYear, startMonth, startDay, 0, 0, 0, 0, time.UTC)
+	days := int(today.Sub(start).Hours() / 24)
+	sprints := days / cfg.SprintDuration
+	if days < 0 && days%cfg.SprintDuration != 0 {
+		sprints--
+	}
+	return cfg.sprintStart.AddDate(0, 0, sprints*cfg.SprintDuration)
+}
@@ -0,0 +1,165 @@
+package p
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// validEnv Environment of a valid configuration
+func validEnv() map[string]string {
+	return map[string]string{
+		"SPREADSHEET_ID":    "sheet",
+		"SLACK_TOKEN":       "xoxb-token",
+		"EMOJI_NAME":        "taco",
+		"MAX_EVERYDAY":      "5",
+		"SPRINT_START_DATE": "07 01 2019",
+		"SPRINT_DURATION":   "14",
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"valid", nil, ""},
+		{"no spreadsheet", map[string]string{"SPREADSHEET_ID": ""}, "SPREADSHEET_ID is required"},
+		{"no token", map[string]string{"SLACK_TOKEN": ""}, "SLACK_TOKEN, or SLACK_CLIENT_ID and SLACK_CLIENT_SECRET"},
+		{"oauth without secret", map[string]string{"SLACK_TOKEN": "", "SLACK_CLIENT_ID": "id"}, "SLACK_TOKEN, or SLACK_CLIENT_ID and SLACK_CLIENT_SECRET"},
+		{"number", map[string]string{"MAX_EVERYDAY": "five"}, `MAX_EVERYDAY: "five" is not a number`},
+		{"boolean", map[string]string{"ALLOW_DIRECT_MESSAGES": "maybe"}, `ALLOW_DIRECT_MESSAGES: "maybe" is not true or false`},
+		{"channel pairs", map[string]string{"ACK_CHANNELS": "C1"}, "ACK_CHANNELS: malformed entries [C1]"},
+		{"no emoji", map[string]string{"EMOJI_NAME": ""}, "EMOJI_NAME or CURRENCIES is required"},
+		{"blank currencies", map[string]string{"CURRENCIES": " , "}, `CURRENCIES: no currency in " , "`},
+		{"currency without name", map[string]string{"CURRENCIES": "taco,:5"}, `CURRENCIES: ":5" has no emoji name`},
+		{"currency limit", map[string]string{"CURRENCIES": "taco:many"}, `CURRENCIES: day limit of "taco:many" is not a number`},
+		{"currency weight", map[string]string{"CURRENCIES": "taco:5:heavy"}, `CURRENCIES: weight of "taco:5:heavy" is not a number`},
+		{"currency twice", map[string]string{"CURRENCIES": "taco,taco"}, "CURRENCIES: taco appears twice"},
+		{"no day limit", map[string]string{"MAX_EVERYDAY": ""}, "day limit of currency taco is required"},
+		{"negative per gift", map[string]string{"MAX_PER_GIFT": "-1"}, "MAX_PER_GIFT: -1 is negative"},
+		{"split policy", map[string]string{"SPLIT_POLICY": "half"}, `SPLIT_POLICY: "half" is neither`},
+		{"unknown location", map[string]string{"LOCATION": "Atlantis"}, `LOCATION: "Atlantis" is neither`},
+		{"no sprint start", map[string]string{"SPRINT_START_DATE": ""}, "SPRINT_START_DATE is required"},
+		{"sprint start", map[string]string{"SPRINT_START_DATE": "2019-01-07"}, `SPRINT_START_DATE: "2019-01-07" is not dd MM yyyy`},
+		{"sprint duration", map[string]string{"SPRINT_DURATION": "0"}, "SPRINT_DURATION is required"},
+		{"poll interval", map[string]string{"SETTINGS_POLL_INTERVAL": "often"}, `SETTINGS_POLL_INTERVAL: "often" is not a duration`},
+		{"chart page size", map[string]string{"CHART_PAGE_SIZE": "100"}, "CHART_PAGE_SIZE: 100 is not between 1 and"},
+		{"ack style", map[string]string{"ACK_STYLE": "loud"}, `ACK_STYLE: "loud" is not one of`},
+		{"ack channel style", map[string]string{"ACK_CHANNELS": "C1:loud"}, `ACK_CHANNELS: "loud" of channel C1 is not one of`},
+		{"feedback style", map[string]string{"FEEDBACK_STYLE": "loud"}, `FEEDBACK_STYLE: "loud" is not one of`},
+		{"feedback channel style", map[string]string{"FEEDBACK_CHANNELS": "C1:loud"}, `FEEDBACK_CHANNELS: "loud" of channel C1 is not one of`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := validEnv()
+			for name, value := range test.env {
+				env[name] = value
+			}
+			cfg, err := LoadConfig("", func(name string) string { return env[name] })
+			if test.want == "" {
+				if err != nil || cfg == nil {
+					t.Fatalf("LoadConfig() = %v, %v, want a configuration", cfg, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"json", "config.json", `{"emoji_name": "rocket"}`, ""},
+		{"yaml", "config.yaml", "emoji_name: rocket\n", ""},
+		{"json unknown key", "config.json", `{"emoji": "rocket"}`, `unknown field "emoji"`},
+		{"yaml unknown key", "config.yml", "emoji: rocket\n", "field emoji not found"},
+		{"extension", "config.toml", `emoji_name = "rocket"`, "is neither .json, .yaml nor .yml"},
+	}
+	env := validEnv()
+	env["EMOJI_NAME"] = ""
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.file)
+			if err := ioutil.WriteFile(path, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(path, func(name string) string { return env[name] })
+			if test.want == "" {
+				if err != nil || cfg.defaultCurrency().Name != "rocket" {
+					t.Fatalf("LoadConfig() = %v, %v, want rocket as currency", cfg, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, test.want)
+			}
+		})
+	}
+	if _, err := LoadConfig(filepath.Join(dir, "missing.json"), func(name string) string { return env[name] }); err == nil || !strings.Contains(err.Error(), "CONFIG_FILE") {
+		t.Errorf("LoadConfig() of a missing file error = %v, want CONFIG_FILE", err)
+	}
+}
+
+func TestSettingsChanges(t *testing.T) {
+	previous := map[string]string{"MAX_EVERYDAY": "5", "VALUES": "teamwork", "GREETING": "Hi"}
+	next := map[string]string{"MAX_EVERYDAY": "10", "GREETING": "Hi", "ACK_STYLE": "thread"}
+	before, after := settingsChanges(previous, next)
+	if want := "ACK_STYLE=unset; MAX_EVERYDAY=5; VALUES=teamwork"; before != want {
+		t.Errorf("settingsChanges() before = %q, want %q", before, want)
+	}
+	if want := "ACK_STYLE=thread; MAX_EVERYDAY=10; VALUES=unset"; after != want {
+		t.Errorf("settingsChanges() after = %q, want %q", after, want)
+	}
+}
+
+func TestApplySettingsAuditsChangesOnly(t *testing.T) {
+	for name, value := range validEnv() {
+		t.Setenv(name, value)
+	}
+	t.Setenv("CONFIG_FILE", "")
+	var audited []string
+	var mutex sync.Mutex
+	fakeSheets(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mutex.Lock()
+			audited = append(audited, r.URL.Path)
+			mutex.Unlock()
+			w.Write([]byte("{}"))
+			return
+		}
+		serveValues(t, [][]interface{}{{"MAX_EVERYDAY", "10"}})(w, r)
+	})
+	base, err := LoadConfig("", os.Getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started, _ := applySettings(base, base, "", true)
+	jobs.Wait()
+	if started.DayLimit != 10 || len(audited) != 0 {
+		t.Errorf("applySettings() at startup = day limit %d with audits %v, want 10 without audit", started.DayLimit, audited)
+	}
+	changed, _ := applySettings(base, base, "", false)
+	jobs.Wait()
+	if changed.DayLimit != 10 || len(audited) != 1 || !strings.Contains(audited[0], auditSheet) {
+		t.Errorf("applySettings() = day limit %d with audits %v, want 10 with one audit", changed.DayLimit, audited)
+	}
+}
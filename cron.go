@@ -0,0 +1,79 @@
+package p
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// cronPrefix Path prefix of scheduled jobs, followed by the job name
+const cronPrefix = "/cron/"
+
+// cronJob A scheduled job, triggered by a request from a scheduler such as Cloud Scheduler
+type cronJob func(cfg *Config, r *http.Request) error
+
+// cronJobs Scheduled jobs by name
+var cronJobs = map[string]cronJob{
+	"chart": postScheduledChart,
+}
+
+// HandleCron handle scheduled job requests on /cron/<job>
+func HandleCron(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	authorization := []byte(r.Header.Get("Authorization"))
+	if cfg.CronSecret == "" || subtle.ConstantTimeCompare(authorization, []byte("Bearer "+cfg.CronSecret)) != 1 {
+		log.Printf("Unauthorized cron request %v\n", r.URL.Path)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, cronPrefix)
+	job, ok := cronJobs[name]
+	if !ok {
+		log.Printf("Strange cron job %v\n", name)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := job(cfg, r); err != nil {
+		log.Printf("Cron job %v failed with error %v\n", name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Cron job %v done\n", name)
+	w.WriteHeader(http.StatusOK)
+}
+
+// postScheduledChart Post the chart of the query, e.g. ?query=week+karma, to the channel or the recognition channel.
+// The team parameter picks the workspace, the SLACK_TOKEN one by default.
+func postScheduledChart(cfg *Config, r *http.Request) error {
+	t := teamFor(cfg, r.URL.Query().Get("team"))
+	if t == nil {
+		return fmt.Errorf("app is not installed in team %v", r.URL.Query().Get("team"))
+	}
+	channel := r.URL.Query().Get("channel")
+	if channel == "" {
+		channel = cfg.RecognitionChannel
+	}
+	if channel == "" {
+		return fmt.Errorf("no channel to post the chart to")
+	}
+	query, err := parseChartQuery(cfg, strings.ToLower("chart "+r.URL.Query().Get("query")))
+	if err != nil {
+		return err
+	}
+	from, to, failed := calculateRangeFrom(cfg, query.Duration)
+	if failed {
+		return fmt.Errorf("unable to calculate the range of %v", query.Duration)
+	}
+	records, err := getRecords(t, from, to, query)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		post(t, channel, noRecordMessage)
+		return nil
+	}
+	postBlocks(t, channel, chartText(cfg, from, to, records, 0), chartBlocks(cfg, from, to, query, records, getAvatars(t), 0))
+	return nil
+}
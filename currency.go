@@ -0,0 +1,48 @@
+package p
+
+import (
+	"fmt"
+	"strings"
+)
+
+// currency A recognition emoji with its own daily limit, weight and leaderboard
+type currency struct {
+	// Name Emoji name without colons, e.g. taco
+	Name string
+	// DayLimit Maximum number of this emoji can be given everyday by each user
+	DayLimit int
+	// Weight Value of one emoji in the combined score
+	Weight int
+}
+
+// defaultCurrency The currency used when none is given, e.g. by the karma syntax
+func (cfg *Config) defaultCurrency() currency {
+	return cfg.currencies[0]
+}
+
+// currencyNamed Find the currency with the name, with or without colons
+func (cfg *Config) currencyNamed(name string) (currency, bool) {
+	name = strings.Trim(name, ":")
+	for _, c := range cfg.currencies {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return currency{}, false
+}
+
+// Emoji The currency emoji in Slack format
+func (c currency) Emoji() string {
+	return fmt.Sprintf(":%s:", c.Name)
+}
+
+// shortestEmoji The shortest currency emoji in Slack format
+func (cfg *Config) shortestEmoji() string {
+	result := cfg.defaultCurrency().Emoji()
+	for _, c := range cfg.currencies {
+		if len(c.Emoji()) < len(result) {
+			result = c.Emoji()
+		}
+	}
+	return result
+}
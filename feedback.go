@@ -0,0 +1,137 @@
+package p
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FeedbackStyle How rejected or trimmed gifts are explained to the giver
+type FeedbackStyle string
+
+const (
+	// EphemeralFeedback Explain with a message only the giver sees
+	EphemeralFeedback FeedbackStyle = "ephemeral"
+	// ReactionsFeedback React with NotAllow, Pray or NoGood
+	ReactionsFeedback FeedbackStyle = "reactions"
+	// BothFeedback Explain and react
+	BothFeedback FeedbackStyle = "both"
+)
+
+// feedbackStyles Supported feedback styles
+var feedbackStyles = []FeedbackStyle{EphemeralFeedback, ReactionsFeedback, BothFeedback}
+
+// feedbackTemplates Feedback messages. Placeholders are {receiver}, {emoji}, {limit}, {reset}, {given}, {requested}, {reason} and {channel}.
+type feedbackTemplates struct {
+	SelfGiving      string `json:"self_giving" yaml:"self_giving"`
+	BotReceiver     string `json:"bot_receiver" yaml:"bot_receiver"`
+	LimitReached    string `json:"limit_reached" yaml:"limit_reached"`
+	Trimmed         string `json:"trimmed" yaml:"trimmed"`
+	DirectMessage   string `json:"direct_message" yaml:"direct_message"`
+	PrivateChannel  string `json:"private_channel" yaml:"private_channel"`
+	ChannelExcluded string `json:"channel_excluded" yaml:"channel_excluded"`
+	BannedGiver     string `json:"banned_giver" yaml:"banned_giver"`
+	BannedReceiver  string `json:"banned_receiver" yaml:"banned_receiver"`
+}
+
+// defaultFeedbackTemplates Feedback messages unless the configuration overrides them
+var defaultFeedbackTemplates = feedbackTemplates{
+	SelfGiving:      "You can not give {emoji} to yourself. Mention a teammate instead, e.g. `@teammate {emoji}`.",
+	BotReceiver:     "{receiver} is a bot and can not receive {emoji}. Mention a person instead.",
+	LimitReached:    "You already gave your {limit} {emoji} for today. Your allowance resets {reset}.",
+	Trimmed:         "{receiver} received {given} {emoji} instead of {requested}: {reason}.",
+	DirectMessage:   "Gifts in direct messages do not count. Give in a public channel so everyone can see it.",
+	PrivateChannel:  "Gifts in private channels do not count. Give in a public channel so everyone can see it.",
+	ChannelExcluded: "Gifts in {channel} do not count. Give in another channel instead.",
+	BannedGiver:     "You can not give {emoji} at the moment. Ask an admin if you think this is a mistake.",
+	BannedReceiver:  "{receiver} can not receive {emoji} at the moment.",
+}
+
+// feedbackStyleOr Parse the feedback style, the fallback when it is not supported
+func feedbackStyleOr(name string, fallback FeedbackStyle) FeedbackStyle {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, style := range feedbackStyles {
+		if string(style) == name {
+			return style
+		}
+	}
+	return fallback
+}
+
+// feedbackStyleOf Feedback style of the channel
+func (cfg *Config) feedbackStyleOf(channel string) FeedbackStyle {
+	if style, ok := cfg.FeedbackChannels[channel]; ok {
+		return style
+	}
+	return cfg.FeedbackStyle
+}
+
+// reacts Whether rejections are shown with reactions
+func (s FeedbackStyle) reacts() bool {
+	return s == ReactionsFeedback || s == BothFeedback
+}
+
+// explains Whether rejections are explained with an ephemeral message
+func (s FeedbackStyle) explains() bool {
+	return s == EphemeralFeedback || s == BothFeedback
+}
+
+// renderFeedback Replace the placeholders of the template
+func renderFeedback(template string, values map[string]string) string {
+	var pairs []string
+	for name, value := range values {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// feedbackLines Explain every skipped or trimmed outcome and every daily limit reached
+func feedbackLines(cfg *Config, outcomes []receiverOutcome, emoji string, reached []currency) []string {
+	var lines []string
+	for _, o := range outcomes {
+		values := map[string]string{
+			"receiver":  fmt.Sprintf("<@%s>", o.Receiver.ID),
+			"emoji":     emoji,
+			"given":     fmt.Sprintf("%d", o.Given),
+			"requested": fmt.Sprintf("%d", o.Requested),
+			"reason":    o.Reason,
+		}
+		switch {
+		case o.Reason == selfGivingReason:
+			lines = append(lines, renderFeedback(cfg.Feedback.SelfGiving, values))
+		case o.Reason == botReceiverReason:
+			lines = append(lines, renderFeedback(cfg.Feedback.BotReceiver, values))
+		case o.Reason == bannedReceiverReason:
+			lines = append(lines, renderFeedback(cfg.Feedback.BannedReceiver, values))
+		case o.LimitReached:
+			// Explained once by currency below
+		case o.Given < o.Requested:
+			values["emoji"] = o.Currency.Emoji()
+			lines = append(lines, renderFeedback(cfg.Feedback.Trimmed, values))
+		}
+	}
+	for _, c := range reached {
+		lines = append(lines, renderFeedback(cfg.Feedback.LimitReached, map[string]string{
+			"emoji": c.Emoji(),
+			"limit": fmt.Sprintf("%d", c.DayLimit),
+			"reset": resetTime(cfg),
+		}))
+	}
+	return lines
+}
+
+// explain Send the feedback lines to the giver if the channel explains rejections
+func explain(t *team, channel string, giverID string, lines []string) {
+	if len(lines) == 0 || !t.Config.feedbackStyleOf(channel).explains() {
+		return
+	}
+	postEphemeral(t, channel, giverID, strings.Join(lines, "\n"))
+}
+
+// resetTime When daily limits reset, rendered in the reader's timezone
+func resetTime(cfg *Config) string {
+	now := cfg.now()
+	year, month, day := now.Date()
+	midnight := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", midnight.Unix(), midnight.Format(time.RFC1123))
+}
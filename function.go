@@ -5,27 +5,106 @@ import (
 	"bytes"
 	"log"
 	"net/http"
+	"strings"
 )
 
 // Handle handle every requests
 func Handle(w http.ResponseWriter, r *http.Request) {
+	// The install flow is browser navigation rather than requests from Slack
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/install"):
+		HandleInstall(w, r)
+		return
+	case strings.HasSuffix(r.URL.Path, "/oauth_redirect"):
+		HandleOAuthRedirect(w, r)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	tw := &trackedWriter{ResponseWriter: w}
+	cfg := currentConfig()
+	// Interactivity payloads and slash commands are form encoded, events are JSON
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if isCommand(body) {
+			respond(tw, parseCommand(cfg, r.Header, body, tw))
+		} else {
+			respond(tw, parseInteraction(cfg, r.Header, body, tw))
+		}
+		return
+	}
+	respond(tw, parseEvent(cfg, body, tw))
+}
+
+// HandleEvents handle Events API requests
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	if body, ok := readBody(w, r); ok {
+		tw := &trackedWriter{ResponseWriter: w}
+		respond(tw, parseEvent(currentConfig(), body, tw))
+	}
+}
+
+// HandleCommands handle slash command requests
+func HandleCommands(w http.ResponseWriter, r *http.Request) {
+	if body, ok := readBody(w, r); ok {
+		tw := &trackedWriter{ResponseWriter: w}
+		respond(tw, parseCommand(currentConfig(), r.Header, body, tw))
+	}
+}
+
+// HandleInteractions handle interactivity requests
+func HandleInteractions(w http.ResponseWriter, r *http.Request) {
+	if body, ok := readBody(w, r); ok {
+		tw := &trackedWriter{ResponseWriter: w}
+		respond(tw, parseInteraction(currentConfig(), r.Header, body, tw))
+	}
+}
+
+// readBody Read and log the request body
+func readBody(w http.ResponseWriter, r *http.Request) (string, bool) {
 	buffer := new(bytes.Buffer)
 	_, err := buffer.ReadFrom(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Fatal("Error reading buffer from body.")
-		return
+		log.Printf("Error reading buffer from body. %v\n", err)
+		return "", false
 	}
 	log.Printf("Header: %v\n", r.Header)
 	body := buffer.String()
 	log.Printf("Body: %v\n", body)
-	succeed := parseEvent(body, w)
+	return body, true
+}
+
+// trackedWriter Response writer remembering whether the handler already wrote a response
+type trackedWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+// WriteHeader Write the status and remember it was written
+func (w *trackedWriter) WriteHeader(status int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write Write the body and remember it was written, the status is implicitly OK
+func (w *trackedWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// respond Write the status of the request, unless a response was already written
+func respond(w *trackedWriter, succeed bool) {
 	if !succeed {
-		log.Printf("Unable to parse event. Error %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("Unable to parse request.")
+		if !w.written {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
 	log.Printf("Done")
-	return
 }
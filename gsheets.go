@@ -9,38 +9,40 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/sheets/v4"
 )
 
-// givingSummary model represents each Giving Summary row in Google Sheets
-type givingSummary struct {
-	Name  string
-	Date  string
-	Total string
-}
-
-var today = timeIn(location, time.Now()).Format("02-Jan 2006")
-
 //	writeRange Start range to write raw data
 const writeRange = "A2"
 
-//	spreadsheetID if of the spreadsheet
-var spreadsheetID = os.Getenv("SPREADSHEET_ID")
+// service Google Sheets service, connected on first use by sheetsService
+var service *sheets.Service
+var serviceOnce sync.Once
 
-//	spreadsheetURL Shareable link to the spreadsheet
-var spreadsheetURL = os.Getenv("SPREADSHEET_URL")
-var service = getService()
+// ledgerReadRange Read range for the raw data written by appendRow
+const ledgerReadRange = "A2:P"
 
-// givingSummaryReadRange Read range for the giving summary sheet
-const givingSummaryReadRange = "Pivot Table 1!A3:D"
+// ledgerColumns Number of columns of a raw data row
+const ledgerColumns = 16
 
-// receivingSummaryReadRange Read range for the receiving summary sheet
-const receivingSummaryReadRange = "Pivot Table 2!A3:D"
+// isMissingSheet Whether the error tells the range names a sheet the spreadsheet does not have
+func isMissingSheet(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Message, "Unable to parse range")
+}
+
+// sheetsService Google Sheets service, connected on first use so the package loads without credentials
+func sheetsService() *sheets.Service {
+	serviceOnce.Do(func() { service = getService() })
+	return service
+}
 
 // Get the google sheets service
 func getService() *sheets.Service {
@@ -115,55 +117,188 @@ func saveToken(path string, token *oauth2.Token) {
 }
 
 // Read and print sample data from the sheet
-func readRow(readRange string) [][]interface{} {
-	response, err := service.Spreadsheets.Values.Get(spreadsheetID, readRange).Do()
+func readRow(cfg *Config, readRange string) ([][]interface{}, error) {
+	response, err := sheetsService().Spreadsheets.Values.Get(cfg.SpreadsheetID, readRange).Do()
 	if err != nil {
-		log.Fatalf("Unable to retrieve data from sheet: %v", err)
+		return nil, fmt.Errorf("unable to retrieve data from sheet: %v", err)
 	}
 	if len(response.Values) == 0 {
 		fmt.Println("No data found.")
-		return nil
+		return nil, nil
 	}
 	fmt.Printf("Data found: %v\n", response.Values)
-	return response.Values
+	return response.Values, nil
 }
 
 // write Write data to default range
-func appendRow(values []interface{}) {
+func appendRow(cfg *Config, values []interface{}) error {
 	var valueRange sheets.ValueRange
 	valueRange.Values = append(valueRange.Values, values)
-	_, err := service.Spreadsheets.Values.Append(spreadsheetID, writeRange, &valueRange).ValueInputOption("USER_ENTERED").Do()
+	_, err := sheetsService().Spreadsheets.Values.Append(cfg.SpreadsheetID, writeRange, &valueRange).ValueInputOption("USER_ENTERED").Do()
 	if err != nil {
-		log.Fatalf("Unable to write data %v to sheet. %v", values, err)
+		return fmt.Errorf("unable to write data %v to sheet: %v", values, err)
 	}
+	return nil
 }
 
-func getRecords(from Date, to Date) ChartRecords {
-	log.Printf("From: %v, to %v\n", from, to)
-	records := readRow(receivingSummaryReadRange)
-	chart := map[string]int{}
-	for _, record := range records {
-		// Skip Grand Total record
-		if strings.Contains(fmt.Sprintf("%s %s %s %s", record[0], record[1], record[2], record[3]), "Grand Total") {
-			log.Println("Grand Total record. Skip.")
-			break
-		}
-		receivingSummary := givingSummary{record[0].(string), fmt.Sprintf("%s %s", record[1], record[2]), record[3].(string)}
-		date, err := time.Parse("02-Jan 2006", receivingSummary.Date)
+// appendRows Write the rows in a single request, so either every row is written or none
+func appendRows(cfg *Config, rows [][]interface{}) error {
+	valueRange := sheets.ValueRange{Values: rows}
+	_, err := sheetsService().Spreadsheets.Values.Append(cfg.SpreadsheetID, writeRange, &valueRange).ValueInputOption("USER_ENTERED").Do()
+	return err
+}
+
+// addSheet Add the sheet to the spreadsheet with its header row
+func addSheet(cfg *Config, title string, header []interface{}) error {
+	request := &sheets.BatchUpdateSpreadsheetRequest{Requests: []*sheets.Request{
+		{AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: title}}},
+	}}
+	if _, err := sheetsService().Spreadsheets.BatchUpdate(cfg.SpreadsheetID, request).Do(); err != nil {
+		return err
+	}
+	valueRange := sheets.ValueRange{Values: [][]interface{}{header}}
+	_, err := sheetsService().Spreadsheets.Values.Update(cfg.SpreadsheetID, title+"!A1", &valueRange).ValueInputOption("RAW").Do()
+	return err
+}
+
+// ledgerEntry model represents each raw giving row in Google Sheets
+type ledgerEntry struct {
+	Time     time.Time
+	Giver    string
+	Receiver string
+	Quantity int
+	Message  string
+	Source   Source
+	Currency string
+	Tags     []string
+	// Team Workspace of the gift, empty for rows written before workspaces were stored
+	Team string
+	// Weight Multiplier of the channel the gift was made in
+	Weight int
+	// Channel Channel the gift was made in, empty for rows written before it was stored
+	Channel string
+	// MessageID Id of the message of the gift as in its permalink, e.g. p1547921475007300
+	MessageID string
+	// Adjustment Admin command that wrote the row, empty for gifts
+	Adjustment Adjustment
+	// GiverID User id of the giver, empty for rows written before it was stored
+	GiverID string
+	// ReceiverID User id of the receiver, empty for rows written before it was stored
+	ReceiverID string
+}
+
+// readLedger Read every giving row of the raw data sheet belonging to the workspace.
+// Callers stop on error, an empty ledger would lift every ban and allowance.
+func readLedger(t *team) ([]ledgerEntry, error) {
+	var entries []ledgerEntry
+	rows, err := readRow(t.Config, ledgerReadRange)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		entry, err := toLedgerEntry(t.Config, row)
 		if err != nil {
-			log.Panicf("Unable to parse date %v from Google Sheets!", receivingSummary.Date)
-			return nil
+			log.Printf("Skip ledger row %v with error %v\n", row, err)
+			continue
 		}
-		if isInRange(timeIn(location, date), from, to) {
-			total, err := strconv.Atoi(receivingSummary.Total)
-			if err != nil {
-				log.Fatalf("Unable to parse total %v to int with error %v", receivingSummary.Total, err)
-				return nil
-			}
-			chart[receivingSummary.Name] = total + chart[receivingSummary.Name]
-			log.Printf("Chart: %v\n", chart)
+		if !t.owns(entry) {
+			continue
 		}
+		entries = append(entries, entry)
 	}
+	return entries, nil
+}
+
+// toLedgerEntry Convert a raw row written by prepareRecord to a ledger entry
+func toLedgerEntry(cfg *Config, row []interface{}) (ledgerEntry, error) {
+	cells := make([]string, ledgerColumns)
+	for i := 0; i < len(row) && i < ledgerColumns; i++ {
+		cells[i] = fmt.Sprintf("%v", row[i])
+	}
+	var entry ledgerEntry
+	t, err := time.Parse(time.RFC3339, cells[0])
+	if err != nil {
+		t, err = time.ParseInLocation(dateTimeFormat, cells[1], cfg.location)
+		if err != nil {
+			return entry, fmt.Errorf("unable to parse time of row: %v", err)
+		}
+	}
+	quantity, err := strconv.Atoi(cells[4])
+	if err != nil {
+		return entry, fmt.Errorf("unable to parse quantity %v: %v", cells[4], err)
+	}
+	entry = ledgerEntry{
+		Time:       t.In(cfg.location),
+		Giver:      cells[2],
+		Receiver:   cells[3],
+		Quantity:   quantity,
+		Message:    cells[5],
+		Source:     Source(cells[6]),
+		Currency:   cells[7],
+		Team:       cells[9],
+		Weight:     1,
+		Channel:    cells[11],
+		MessageID:  cells[12],
+		Adjustment: Adjustment(cells[13]),
+		GiverID:    cells[14],
+		ReceiverID: cells[15],
+	}
+	// Rows written before channel profiles existed have no weight
+	if weight, err := strconv.Atoi(cells[10]); err == nil && weight > 0 {
+		entry.Weight = weight
+	}
+	for _, tag := range strings.Fields(cells[8]) {
+		entry.Tags = append(entry.Tags, strings.TrimPrefix(tag, "#"))
+	}
+	// Rows written before sources existed are emoji gifts
+	if entry.Source == "" {
+		entry.Source = EmojiSource
+	}
+	// Rows written before currencies existed are in the default currency
+	if entry.Currency == "" {
+		entry.Currency = cfg.defaultCurrency().Name
+	}
+	return entry, nil
+}
+
+// row Convert the ledger entry to a raw row of the workspace, in the columns written by prepareRecord
+func (entry ledgerEntry) row(t *team) []interface{} {
+	tags := strings.Join(entry.Tags, " ")
+	return []interface{}{entry.Time, entry.Time.Format(dateTimeFormat), entry.Giver, entry.Receiver, entry.Quantity, entry.Message,
+		string(entry.Source), entry.Currency, tags, t.ID, entry.Weight, entry.Channel, entry.MessageID, string(entry.Adjustment),
+		entry.GiverID, entry.ReceiverID}
+}
+
+// getRecords Rank receivers of the workspace ledger entries in range matching the query
+func getRecords(t *team, from Date, to Date, query chartQuery) (ChartRecords, error) {
+	log.Printf("From: %v, to %v, query %+v\n", from, to, query)
+	entries, err := readLedger(t)
+	if err != nil {
+		return nil, err
+	}
+	chart := aggregate(t.Config, entries, from, to, query, receiverOf)
 	log.Printf("Chart: %v\n", chart)
-	return rank(chart)
+	return rank(chart), nil
+}
+
+// aggregate Sum the weighted quantities of the entries in range matching the query by key
+func aggregate(cfg *Config, entries []ledgerEntry, from Date, to Date, query chartQuery, key func(ledgerEntry) string) map[string]int {
+	result := map[string]int{}
+	for _, entry := range entries {
+		if !query.matches(cfg, entry, from, to) {
+			continue
+		}
+		result[key(entry)] += query.value(cfg, entry)
+	}
+	return result
+}
+
+// receiverOf Key ledger entries by receiver
+func receiverOf(entry ledgerEntry) string {
+	return entry.Receiver
+}
+
+// giverOf Key ledger entries by giver
+func giverOf(entry ledgerEntry) string {
+	return entry.Giver
 }
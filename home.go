@@ -0,0 +1,220 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack/slackevents"
+)
+
+// appHomeOpened Event sent when a user opens the app home
+const appHomeOpened = "app_home_opened"
+
+const homeChartActionID = "home_chart"
+
+// homeGiftsLimit Number of last gifts in and out shown in the home tab
+const homeGiftsLimit = 10
+
+const homeTitle = "Your recognition"
+const allowanceFormat = "*Left today:* %s"
+const periodSummaryFormat = "*%s:* received %s, given %s%s"
+const homeRankFormat = ", rank #%d"
+const giftInFormat = "• %d %s from *%s* on %s"
+const giftOutFormat = "• %d %s to *%s* on %s"
+const homeGiftDateFormat = "02 Jan 15:04"
+const nothingText = "nothing"
+
+// homePeriods Periods summarised in the home tab
+var homePeriods = []Duration{Week, Sprint, Year}
+
+// appHomeOpenedEvent A user opened the app home, the library does not know this event yet
+type appHomeOpenedEvent struct {
+	Type    string `json:"type"`
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+	Tab     string `json:"tab"`
+}
+
+func init() {
+	slackevents.EventsAPIInnerEventMapping[appHomeOpened] = appHomeOpenedEvent{}
+}
+
+// handleAppHomeOpened Publish the dashboard when the user opens the home tab
+func handleAppHomeOpened(t *team, event *appHomeOpenedEvent) {
+	if event.Tab != "home" {
+		log.Printf("App %v tab opened. Return.\n", event.Tab)
+		return
+	}
+	publishHome(t, event.User, "")
+}
+
+// handleHomeChartAction Show the chart of the period in the home tab
+func handleHomeChartAction(t *team, payload interactionPayload, action blockAction) {
+	period, ok := durationNamed(action.Value)
+	if !ok {
+		log.Printf("Strange home chart period %v\n", action.Value)
+		return
+	}
+	publishHome(t, payload.User.ID, period)
+}
+
+// refreshHomes Publish the home of everyone involved in the gift
+func refreshHomes(g gift) {
+	publishHome(g.Team, g.Giver.ID, "")
+	for _, receiver := range g.Receivers {
+		publishHome(g.Team, receiver.ID, "")
+	}
+}
+
+// publishHome Publish the dashboard of the user, with the chart of the period if any
+func publishHome(t *team, userID string, chartPeriod Duration) {
+	user, err := t.client.GetUserInfo(userID)
+	if err != nil {
+		log.Printf("Error getting home user %v info %v\n", userID, err)
+		return
+	}
+	entries, err := readLedger(t)
+	if err != nil {
+		log.Printf("Unable to read the ledger for the home of user %v with error %v\n", userID, err)
+		return
+	}
+	home := homeView(t.Config, user.Profile.RealName, entries, chartPeriod)
+	if err := callAPI(t, "views.publish", map[string]interface{}{"user_id": userID, "view": home}); err != nil {
+		log.Printf("Unable to publish home of user %v with error %v\n", userID, err)
+		return
+	}
+	log.Printf("Home of user %v published\n", userID)
+}
+
+// homeView Build the home tab of the user from the ledger entries
+func homeView(cfg *Config, name string, entries []ledgerEntry, chartPeriod Duration) view {
+	blocks := []block{
+		{Type: "header", Text: plainText(homeTitle)},
+		{Type: "section", Text: markdown(fmt.Sprintf(allowanceFormat, formatQuantities(cfg, remainingIn(cfg, entries, name))))},
+	}
+	var summaries []string
+	for _, period := range homePeriods {
+		from, to, failed := calculateRangeFrom(cfg, period)
+		if failed {
+			continue
+		}
+		received := map[string]int{}
+		given := map[string]int{}
+		for _, c := range cfg.currencies {
+			query := chartQuery{Duration: period, Currency: c.Name}
+			received[c.Name] = aggregate(cfg, entries, from, to, query, receiverOf)[name]
+			given[c.Name] = aggregate(cfg, entries, from, to, query, giverOf)[name]
+		}
+		rankText := ""
+		if rank := rankOf(name, rank(aggregate(cfg, entries, from, to, chartQuery{Duration: period}, receiverOf))); rank > 0 {
+			rankText = fmt.Sprintf(homeRankFormat, rank)
+		}
+		summaries = append(summaries, fmt.Sprintf(periodSummaryFormat, period, formatQuantities(cfg, received), formatQuantities(cfg, given), rankText))
+	}
+	blocks = append(blocks,
+		block{Type: "section", Text: markdown(strings.Join(summaries, "\n"))},
+		block{Type: "divider"},
+		block{Type: "section", Text: markdown("*Last received*\n" + formatGifts(lastGifts(entries, receiverOf, name), giftInFormat, giverOf))},
+		block{Type: "section", Text: markdown("*Last given*\n" + formatGifts(lastGifts(entries, giverOf, name), giftOutFormat, receiverOf))},
+		block{Type: "divider"},
+		homeChartButtons(chartPeriod),
+	)
+	if chartPeriod != "" {
+		query := chartQuery{Duration: chartPeriod}
+		if from, to, failed := calculateRangeFrom(cfg, chartPeriod); !failed {
+			records := rank(aggregate(cfg, entries, from, to, query, receiverOf))
+			text := noRecordMessage
+			if len(records) > 0 {
+				text = chartText(cfg, from, to, records, 0)
+			}
+			blocks = append(blocks, block{Type: "section", Text: markdown(text)})
+		}
+	}
+	return view{Type: "home", Blocks: blocks}
+}
+
+// homeChartButtons Render one button per chart period
+func homeChartButtons(selected Duration) block {
+	var elements []interface{}
+	for _, duration := range durations {
+		style := ""
+		if duration == selected {
+			style = "primary"
+		}
+		elements = append(elements, buttonElement{
+			Type:     "button",
+			Text:     plainText(string(duration)),
+			ActionID: homeChartActionID + "_" + strings.ToLower(string(duration)),
+			Value:    string(duration),
+			Style:    style,
+		})
+	}
+	return block{Type: "actions", Elements: elements}
+}
+
+// remainingIn What the giver can still give today by currency name, computed from the entries
+func remainingIn(cfg *Config, entries []ledgerEntry, giverRealName string) map[string]int {
+	givenToday := givenTodayIn(cfg, entries, giverRealName)
+	result := map[string]int{}
+	for _, c := range cfg.currencies {
+		if remaining := c.DayLimit - givenToday[c.Name]; remaining > 0 {
+			result[c.Name] = remaining
+		}
+	}
+	return result
+}
+
+// rankOf Return the 1 based rank of the name in the records, 0 when absent
+func rankOf(name string, records ChartRecords) int {
+	for i, record := range records {
+		if record.Key == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// lastGifts Return the latest entries whose key is the name, newest first
+func lastGifts(entries []ledgerEntry, key func(ledgerEntry) string, name string) []ledgerEntry {
+	var result []ledgerEntry
+	for _, entry := range entries {
+		if key(entry) == name && entry.Adjustment.ranks() {
+			result = append(result, entry)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.After(result[j].Time)
+	})
+	if len(result) > homeGiftsLimit {
+		result = result[:homeGiftsLimit]
+	}
+	return result
+}
+
+// formatGifts Render gifts one per line, other is the person on the other side of the gift
+func formatGifts(entries []ledgerEntry, format string, other func(ledgerEntry) string) string {
+	if len(entries) == 0 {
+		return nothingText
+	}
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf(format, entry.Quantity, fmt.Sprintf(":%s:", entry.Currency), other(entry), entry.Time.Format(homeGiftDateFormat)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatQuantities Render quantities by currency name in currency order, e.g. "3 :taco: 1 :rocket:"
+func formatQuantities(cfg *Config, quantities map[string]int) string {
+	var parts []string
+	for _, c := range cfg.currencies {
+		if quantities[c.Name] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", quantities[c.Name], c.Emoji()))
+		}
+	}
+	if len(parts) == 0 {
+		return nothingText
+	}
+	return strings.Join(parts, " ")
+}
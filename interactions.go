@@ -0,0 +1,267 @@
+package p
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// InteractionType Type of a Slack interactivity payload
+type InteractionType string
+
+const (
+	// BlockActions A user clicked a Block Kit interactive element
+	BlockActions InteractionType = "block_actions"
+	// ViewSubmission A user submitted a modal
+	ViewSubmission InteractionType = "view_submission"
+	// Shortcut A user triggered a global shortcut
+	Shortcut InteractionType = "shortcut"
+	// MessageAction A user triggered a message shortcut
+	MessageAction InteractionType = "message_action"
+)
+
+const (
+	chartPageActionID   = "chart_page"
+	chartPeriodActionID = "chart_period"
+)
+
+// interactionPayload Slack interactivity payload, only the fields used by this app.
+// The library predates Block Kit so it has no type for it.
+type interactionPayload struct {
+	Type        InteractionType `json:"type"`
+	CallbackID  string          `json:"callback_id"`
+	TriggerID   string          `json:"trigger_id"`
+	ResponseURL string          `json:"response_url"`
+	Team        slack.Team      `json:"team"`
+	User        slack.User      `json:"user"`
+	Channel     slack.Channel   `json:"channel"`
+	Message     slack.Msg       `json:"message"`
+	Container   struct {
+		MessageTs string `json:"message_ts"`
+		ChannelID string `json:"channel_id"`
+	} `json:"container"`
+	Actions []blockAction `json:"actions"`
+	View    viewPayload   `json:"view"`
+}
+
+// blockAction A Block Kit element interaction
+type blockAction struct {
+	ActionID string `json:"action_id"`
+	BlockID  string `json:"block_id"`
+	Value    string `json:"value"`
+}
+
+// viewPayload A modal or home view sent back by Slack
+type viewPayload struct {
+	ID              string `json:"id"`
+	CallbackID      string `json:"callback_id"`
+	PrivateMetadata string `json:"private_metadata"`
+	State           struct {
+		Values map[string]map[string]viewStateValue `json:"values"`
+	} `json:"state"`
+}
+
+// viewStateValue Value of an input element of a submitted view
+type viewStateValue struct {
+	Type           string   `json:"type"`
+	Value          string   `json:"value"`
+	SelectedUsers  []string `json:"selected_users"`
+	SelectedOption *struct {
+		Value string `json:"value"`
+	} `json:"selected_option"`
+}
+
+// chartState What a chart message shows, stored in its button values
+type chartState struct {
+	Query string `json:"query"`
+	Page  int    `json:"page"`
+}
+
+// blockActionHandler Handle a block action, routed by action id prefix
+type blockActionHandler func(t *team, payload interactionPayload, action blockAction)
+
+// viewSubmissionHandler Handle a modal submission, routed by view callback id.
+// The result is written back to Slack, e.g. validation errors, or nil to close the modal.
+type viewSubmissionHandler func(t *team, payload interactionPayload) interface{}
+
+// callbackHandler Handle a global or message shortcut, routed by callback id
+type callbackHandler func(t *team, payload interactionPayload)
+
+// interactionRouter Dispatch interactivity payloads to typed handlers
+type interactionRouter struct {
+	blockActions    map[string]blockActionHandler
+	viewSubmissions map[string]viewSubmissionHandler
+	shortcuts       map[string]callbackHandler
+	messageActions  map[string]callbackHandler
+}
+
+// interactions Routes of every interaction this app understands
+var interactions = &interactionRouter{
+	blockActions: map[string]blockActionHandler{
+		chartPageActionID:   handleChartAction,
+		chartPeriodActionID: handleChartAction,
+		homeChartActionID:   handleHomeChartAction,
+	},
+	viewSubmissions: map[string]viewSubmissionHandler{
+		giveModalID: handleGiveSubmission,
+	},
+	shortcuts: map[string]callbackHandler{
+		giveShortcutID: handleGiveShortcut,
+	},
+	messageActions: map[string]callbackHandler{
+		awardMessageActionID: handleAwardMessage,
+	},
+}
+
+// route Dispatch the payload to its handler with the workspace it came from and return the response to write, if any
+func (router *interactionRouter) route(cfg *Config, payload interactionPayload) (interface{}, error) {
+	t := teamFor(cfg, payload.Team.ID)
+	if t == nil {
+		return nil, fmt.Errorf("app is not installed in team %v", payload.Team.ID)
+	}
+	switch payload.Type {
+	case BlockActions:
+		// Acknowledged right away, the handlers read the sheet and update messages within Slack's 3 seconds otherwise
+		for _, action := range payload.Actions {
+			handler, ok := router.blockActionHandler(action.ActionID)
+			if !ok {
+				log.Printf("Strange block action %v\n", action.ActionID)
+				continue
+			}
+			action := action
+			background(func() { handler(t, payload, action) })
+		}
+		return nil, nil
+	case ViewSubmission:
+		handler, ok := router.viewSubmissions[payload.View.CallbackID]
+		if !ok {
+			return nil, fmt.Errorf("no handler for view %v", payload.View.CallbackID)
+		}
+		return handler(t, payload), nil
+	case Shortcut:
+		handler, ok := router.shortcuts[payload.CallbackID]
+		if !ok {
+			return nil, fmt.Errorf("no handler for shortcut %v", payload.CallbackID)
+		}
+		handler(t, payload)
+		return nil, nil
+	case MessageAction:
+		handler, ok := router.messageActions[payload.CallbackID]
+		if !ok {
+			return nil, fmt.Errorf("no handler for message action %v", payload.CallbackID)
+		}
+		handler(t, payload)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("strange interaction type %v", payload.Type)
+}
+
+// blockActionHandler Find the handler of the action id by the longest matching prefix.
+// Action ids must be unique within a block so they may carry a suffix.
+func (router *interactionRouter) blockActionHandler(actionID string) (blockActionHandler, bool) {
+	var result blockActionHandler
+	longest := -1
+	for prefix, handler := range router.blockActions {
+		if strings.HasPrefix(actionID, prefix) && len(prefix) > longest {
+			result = handler
+			longest = len(prefix)
+		}
+	}
+	return result, longest >= 0
+}
+
+// verifyRequest Verify the request signature with the signing secret
+func verifyRequest(cfg *Config, header http.Header, body string) error {
+	if cfg.SigningSecret == "" {
+		return fmt.Errorf("SIGNING_SECRET is not configured")
+	}
+	verifier, err := slack.NewSecretsVerifier(header, cfg.SigningSecret)
+	if err != nil {
+		return err
+	}
+	if _, err := verifier.Write([]byte(body)); err != nil {
+		return err
+	}
+	return verifier.Ensure()
+}
+
+// parseInteraction Verify, parse and route a form encoded interactivity request from Slack
+func parseInteraction(cfg *Config, header http.Header, body string, w http.ResponseWriter) bool {
+	if err := verifyRequest(cfg, header, body); err != nil {
+		log.Printf("Unable to verify interaction signature with error %v\n", err)
+		return false
+	}
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		log.Printf("Unable to parse interaction form with error %v\n", err)
+		return false
+	}
+	var payload interactionPayload
+	if err := json.Unmarshal([]byte(values.Get("payload")), &payload); err != nil {
+		log.Printf("Unable to unmarshal interaction payload with error %v\n", err)
+		return false
+	}
+	log.Printf("Interaction: %+v\n", payload)
+	response, err := interactions.route(cfg, payload)
+	if err != nil {
+		log.Printf("Unable to route interaction with error %v\n", err)
+		return false
+	}
+	if response != nil {
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			log.Printf("Unable to marshal interaction response with error %v\n", err)
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(encoded); err != nil {
+			log.Printf("Unable to write interaction response with error %v\n", err)
+		}
+	}
+	return true
+}
+
+// handleChartAction Handle chart page and period buttons
+func handleChartAction(t *team, payload interactionPayload, action blockAction) {
+	var state chartState
+	if err := json.Unmarshal([]byte(action.Value), &state); err != nil {
+		log.Printf("Unable to unmarshal chart state %v with error %v\n", action.Value, err)
+		return
+	}
+	updateChart(t, payload.Container.ChannelID, payload.Container.MessageTs, state)
+}
+
+// updateChart Replace the chart message in place with the state
+func updateChart(t *team, channel string, timestamp string, state chartState) {
+	query, err := parseChartQuery(t.Config, state.Query)
+	if err != nil {
+		log.Printf("Unable to parse chart query %v with error %v\n", state.Query, err)
+		return
+	}
+	from, to, failed := calculateRangeFrom(t.Config, query.Duration)
+	if failed {
+		return
+	}
+	records, err := getRecords(t, from, to, query)
+	if err != nil {
+		log.Printf("Unable to get chart records with error %v\n", err)
+		return
+	}
+	text := noRecordMessage
+	if len(records) > 0 {
+		text = chartText(t.Config, from, to, records, state.Page)
+	}
+	blocks := chartBlocks(t.Config, from, to, query, records, getAvatars(t), state.Page)
+	_, _, _, err = t.client.UpdateMessage(channel, timestamp, slack.MsgOptionText(text, false), msgOptionBlocks("chat.update", blocks))
+	if err != nil {
+		log.Printf("Unable to update chart message %v in channel %v with error %v\n", timestamp, channel, err)
+		return
+	}
+	log.Printf("Chart message %v in channel %v updated to %+v\n", timestamp, channel, state)
+}
@@ -0,0 +1,41 @@
+package p
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// jobs Background work started by handlers, drained on shutdown
+var jobs sync.WaitGroup
+
+// background Run the job in the background, tracked so shutdown can wait for it.
+// A panicking job is logged rather than stopping the server with every other job.
+func background(job func()) {
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Background job panicked: %v\n%s", r, debug.Stack())
+			}
+		}()
+		job()
+	}()
+}
+
+// Drain Wait for the background jobs to finish, or for the context to be done
+func Drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
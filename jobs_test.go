@@ -0,0 +1,25 @@
+package p
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBackgroundRecovers(t *testing.T) {
+	done := false
+	background(func() { panic("boom") })
+	background(func() { done = true })
+	jobs.Wait()
+	if !done {
+		t.Error("background() did not run the job after a panicking one")
+	}
+}
+
+func TestReadLedgerError(t *testing.T) {
+	fakeSheets(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 503, "message": "unavailable"}}`, http.StatusServiceUnavailable)
+	})
+	if entries, err := readLedger(&team{ID: "T1", Config: testConfig()}); err == nil {
+		t.Errorf("readLedger() = %v, want an error", entries)
+	}
+}
@@ -0,0 +1,374 @@
+package p
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	giveShortcutID       = "give_tacos"
+	awardMessageActionID = "award_message"
+	giveModalID          = "give_modal"
+	rejectedModalID      = "give_rejected"
+)
+
+// Input block ids of the give modal, also used as action ids
+const (
+	receiversInput = "receivers"
+	quantityInput  = "quantity"
+	currencyInput  = "currency"
+	valueInput     = "value"
+	reasonInput    = "reason"
+)
+
+const giveModalTitle = "Give"
+const giveModalSubmit = "Give"
+const loadingAllowanceMessage = "Checking what you can still give today…"
+const noAllowanceMessage = "You have given everything you could today. Come back tomorrow!"
+const recognitionFormat = "<@%s> gave %d %s to %s"
+const noReceiverError = "Pick at least one person."
+const invalidQuantityError = "Pick a quantity."
+const overAllowanceErrorFormat = "You can only give %d %s more today."
+const giftsDisabledErrorFormat = "Gifts are disabled in <#%s>."
+const noRecognitionChannelMessage = "No channel to post the recognition to. Please run the command from a channel."
+const giftNotGivenFormat = "Your recognition was not posted. %s"
+
+// maxSelectOptions Slack rejects static selects with more options
+const maxSelectOptions = 100
+
+// giveModalPrefill Initial values of the give modal
+type giveModalPrefill struct {
+	Receivers []string
+	Reason    string
+}
+
+// giveModalMetadata State of the give modal kept in its private metadata
+type giveModalMetadata struct {
+	// Channel Where the modal was opened from, used when no recognition channel is configured
+	Channel string `json:"channel"`
+}
+
+// handleGiveShortcut Open the give modal from the global shortcut
+func handleGiveShortcut(t *team, payload interactionPayload) {
+	openGiveModal(t, payload.TriggerID, payload.User.ID, "", giveModalPrefill{})
+}
+
+// handleAwardMessage Open the give modal crediting the author of the message, with its permalink as reason.
+// Bots and self-giving are rejected the same way as gifts in messages.
+func handleAwardMessage(t *team, payload interactionPayload) {
+	message := payload.Message
+	if message.BotID != "" || message.User == "" {
+		openRejectedModal(t, payload.TriggerID, botReceiverReason)
+		return
+	}
+	if message.User == payload.User.ID {
+		openRejectedModal(t, payload.TriggerID, selfGivingReason)
+		return
+	}
+	author, err := t.client.GetUserInfo(message.User)
+	if err != nil {
+		log.Printf("Error getting author %v info %v\n", message.User, err)
+		return
+	}
+	if author.IsBot {
+		openRejectedModal(t, payload.TriggerID, botReceiverReason)
+		return
+	}
+	permalink, err := t.client.GetPermalink(&slack.PermalinkParameters{Channel: payload.Channel.ID, Ts: message.Timestamp})
+	if err != nil {
+		log.Printf("Unable to get permalink of message %v with error %v\n", message.Timestamp, err)
+	}
+	openGiveModal(t, payload.TriggerID, payload.User.ID, payload.Channel.ID, giveModalPrefill{
+		Receivers: []string{author.ID},
+		Reason:    permalink,
+	})
+}
+
+// openRejectedModal Explain to the giver why the gift can not be made
+func openRejectedModal(t *team, triggerID string, reason string) {
+	openView(t, triggerID, messageModal(rejectedModalID, fmt.Sprintf("Sorry, %s.", reason)))
+}
+
+// openGiveModal Open the give modal for the giver with the quantity limited to what is left today.
+// The trigger expires after 3 seconds, so the modal is opened while loading and the allowance filled in once read.
+func openGiveModal(t *team, triggerID string, giverID string, channel string, prefill giveModalPrefill) {
+	metadata, err := json.Marshal(giveModalMetadata{Channel: channel})
+	if err != nil {
+		log.Printf("Unable to marshal give modal metadata with error %v\n", err)
+		return
+	}
+	viewID := openView(t, triggerID, messageModal(giveModalID, loadingAllowanceMessage))
+	if viewID == "" {
+		return
+	}
+	background(func() {
+		giver, err := t.client.GetUserInfo(giverID)
+		if err != nil {
+			log.Printf("Error getting giver %v info %v\n", giverID, err)
+			updateView(t, viewID, messageModal(giveModalID, ledgerUnavailableMessage))
+			return
+		}
+		remaining, err := remainingToday(t, giver.Profile.RealName)
+		if err != nil {
+			log.Printf("Unable to read the allowance of %v with error %v\n", giverID, err)
+			updateView(t, viewID, messageModal(giveModalID, ledgerUnavailableMessage))
+			return
+		}
+		updateView(t, viewID, giveModal(t.Config, remaining, string(metadata), prefill))
+	})
+}
+
+// messageModal A give modal showing only the text, without submit button
+func messageModal(callbackID string, text string) view {
+	return view{
+		Type:       "modal",
+		CallbackID: callbackID,
+		Title:      plainText(giveModalTitle),
+		Close:      plainText("Close"),
+		Blocks:     []block{{Type: "section", Text: markdown(text)}},
+	}
+}
+
+// remainingToday What the giver can still give today by currency name
+func remainingToday(t *team, giverRealName string) (map[string]int, error) {
+	entries, err := readLedger(t)
+	if err != nil {
+		return nil, err
+	}
+	return remainingIn(t.Config, entries, giverRealName), nil
+}
+
+// giveModal Build the give modal, quantities go up to the highest remaining allowance
+func giveModal(cfg *Config, remaining map[string]int, metadata string, prefill giveModalPrefill) view {
+	modal := view{
+		Type:            "modal",
+		CallbackID:      giveModalID,
+		Title:           plainText(giveModalTitle),
+		Close:           plainText("Cancel"),
+		PrivateMetadata: metadata,
+	}
+	maxQuantity := 0
+	var currencyOptions []option
+	for _, c := range cfg.currencies {
+		if remaining[c.Name] == 0 {
+			continue
+		}
+		if remaining[c.Name] > maxQuantity {
+			maxQuantity = remaining[c.Name]
+		}
+		currencyOptions = append(currencyOptions, option{Text: plainText(fmt.Sprintf("%s (%d left)", c.Emoji(), remaining[c.Name])), Value: c.Name})
+	}
+	if maxQuantity == 0 {
+		modal.Blocks = []block{{Type: "section", Text: markdown(noAllowanceMessage)}}
+		return modal
+	}
+	if cfg.MaxPerGift > 0 && maxQuantity > cfg.MaxPerGift {
+		maxQuantity = cfg.MaxPerGift
+	}
+	if maxQuantity > maxSelectOptions {
+		maxQuantity = maxSelectOptions
+	}
+
+	modal.Submit = plainText(giveModalSubmit)
+	modal.Blocks = append(modal.Blocks, block{
+		Type:    "input",
+		BlockID: receiversInput,
+		Label:   plainText("To"),
+		Element: selectElement{Type: "multi_users_select", ActionID: receiversInput, Placeholder: plainText("Pick people"), InitialUsers: prefill.Receivers},
+	})
+	var quantityOptions []option
+	for i := 1; i <= maxQuantity; i++ {
+		quantityOptions = append(quantityOptions, newOption(strconv.Itoa(i), strconv.Itoa(i)))
+	}
+	modal.Blocks = append(modal.Blocks, block{
+		Type:    "input",
+		BlockID: quantityInput,
+		Label:   plainText("How many"),
+		Element: selectElement{Type: "static_select", ActionID: quantityInput, Options: quantityOptions, InitialOption: &quantityOptions[0]},
+	})
+	if len(currencyOptions) > 1 {
+		modal.Blocks = append(modal.Blocks, block{
+			Type:    "input",
+			BlockID: currencyInput,
+			Label:   plainText("What"),
+			Element: selectElement{Type: "static_select", ActionID: currencyInput, Options: currencyOptions, InitialOption: &currencyOptions[0]},
+		})
+	}
+	if len(cfg.Values) > 0 {
+		var valueOptions []option
+		for _, value := range cfg.Values {
+			valueOptions = append(valueOptions, newOption("#"+value, value))
+		}
+		modal.Blocks = append(modal.Blocks, block{
+			Type:     "input",
+			BlockID:  valueInput,
+			Label:    plainText("Value"),
+			Optional: true,
+			Element:  selectElement{Type: "static_select", ActionID: valueInput, Placeholder: plainText("Pick a value"), Options: valueOptions},
+		})
+	}
+	modal.Blocks = append(modal.Blocks, block{
+		Type:    "input",
+		BlockID: reasonInput,
+		Label:   plainText("Why"),
+		Element: plainTextInput{Type: "plain_text_input", ActionID: reasonInput, Multiline: true, InitialValue: prefill.Reason},
+	})
+	return modal
+}
+
+// handleGiveSubmission Validate the give modal, then close it and post and record the recognition in the background.
+// Checks that read the sheet run in the background too, their problems are sent to the giver in a direct message.
+func handleGiveSubmission(t *team, payload interactionPayload) interface{} {
+	values := payload.View.State.Values
+	giver, err := t.client.GetUserInfo(payload.User.ID)
+	if err != nil {
+		log.Printf("Error getting giver %v info %v\n", payload.User.ID, err)
+		return nil
+	}
+
+	c := t.Config.defaultCurrency()
+	if selected := values[currencyInput][currencyInput].SelectedOption; selected != nil {
+		if named, ok := t.Config.currencyNamed(selected.Value); ok {
+			c = named
+		}
+	}
+	quantity := 0
+	if selected := values[quantityInput][quantityInput].SelectedOption; selected != nil {
+		quantity, _ = strconv.Atoi(selected.Value)
+	}
+	if quantity <= 0 {
+		return newViewErrors(map[string]string{quantityInput: invalidQuantityError})
+	}
+
+	receivers, receiversError := modalReceivers(t, giver, values[receiversInput][receiversInput].SelectedUsers)
+	if receiversError != "" {
+		return newViewErrors(map[string]string{receiversInput: receiversError})
+	}
+	var metadata giveModalMetadata
+	if err := json.Unmarshal([]byte(payload.View.PrivateMetadata), &metadata); err != nil {
+		log.Printf("Unable to unmarshal give modal metadata with error %v\n", err)
+	}
+	channel := t.Config.RecognitionChannel
+	if channel == "" {
+		channel = metadata.Channel
+	}
+	if channel == "" {
+		return newViewErrors(map[string]string{reasonInput: noRecognitionChannelMessage})
+	}
+
+	g := gift{
+		Team:       t,
+		Channel:    channel,
+		Giver:      giver,
+		Receivers:  receivers,
+		Quantities: map[string]int{c.Name: quantity},
+		Source:     ModalSource,
+	}
+	if selected := values[valueInput][valueInput].SelectedOption; selected != nil {
+		g.Tags = []string{selected.Value}
+	}
+	g.Text = recognitionText(g, c, quantity, values[reasonInput][reasonInput].Value)
+	background(func() { submitGift(g, c, quantity) })
+	return nil
+}
+
+// submitGift Check the channel policy and profile, bans and the allowance of the giver then post and record the recognition
+func submitGift(g gift, c currency, quantity int) {
+	t := g.Team
+	// Without a recognition channel the gift goes to the channel the modal was opened from, which may not count
+	if feedback := t.Config.channelPolicyFeedback(g.Channel, channelTypeOf(t, g.Channel)); feedback != "" {
+		postDirect(t, g.Giver.ID, fmt.Sprintf(giftNotGivenFormat, feedback))
+		return
+	}
+	g.Profile = channelProfileOf(t, g.Channel)
+	if g.Profile.Disabled {
+		postDirect(t, g.Giver.ID, fmt.Sprintf(giftNotGivenFormat, fmt.Sprintf(giftsDisabledErrorFormat, g.Channel)))
+		return
+	}
+	// Bans are checked before posting, give would skip the gift after the recognition is public
+	entries, err := readLedger(t)
+	if err != nil {
+		log.Printf("Unable to read the ledger with error %v\n", err)
+		postDirect(t, g.Giver.ID, fmt.Sprintf(giftNotGivenFormat, ledgerUnavailableMessage))
+		return
+	}
+	if isBanned(entries, g.Giver.ID) {
+		postDirect(t, g.Giver.ID, fmt.Sprintf(giftNotGivenFormat, renderFeedback(t.Config.Feedback.BannedGiver, map[string]string{"emoji": c.Emoji()})))
+		return
+	}
+	for _, receiver := range g.Receivers {
+		if isBanned(entries, receiver.ID) {
+			values := map[string]string{"receiver": fmt.Sprintf("<@%s>", receiver.ID), "emoji": c.Emoji()}
+			postDirect(t, g.Giver.ID, fmt.Sprintf(giftNotGivenFormat, renderFeedback(t.Config.Feedback.BannedReceiver, values)))
+			return
+		}
+	}
+	remaining := remainingIn(t.Config, entries, g.Giver.Profile.RealName)[c.Name]
+	requested, _, _ := allocate(t.Config, quantity, len(g.Receivers), remaining)
+	total := 0
+	for _, r := range requested {
+		total += r
+	}
+	if total > remaining {
+		postDirect(t, g.Giver.ID, fmt.Sprintf(giftNotGivenFormat, fmt.Sprintf(overAllowanceErrorFormat, remaining, c.Emoji())))
+		return
+	}
+	postRecognition(g)
+}
+
+// modalReceivers Resolve the picked users, returning an error message for bots and self-giving
+func modalReceivers(t *team, giver *slack.User, userIDs []string) ([]*slack.User, string) {
+	if len(userIDs) == 0 {
+		return nil, noReceiverError
+	}
+	var receivers []*slack.User
+	for _, userID := range userIDs {
+		receiver, err := t.client.GetUserInfo(userID)
+		if err != nil {
+			log.Printf("Error getting receiver %v info %v\n", userID, err)
+			return nil, err.Error()
+		}
+		if receiver.IsBot {
+			return nil, fmt.Sprintf("<@%s>: %s", receiver.ID, botReceiverReason)
+		}
+		if receiver.ID == giver.ID {
+			return nil, selfGivingReason
+		}
+		receivers = append(receivers, receiver)
+	}
+	return receivers, ""
+}
+
+// recognitionText Render the recognition message posted for a gift made from the modal
+func recognitionText(g gift, c currency, quantity int, reason string) string {
+	var mentions []string
+	for _, receiver := range g.Receivers {
+		mentions = append(mentions, fmt.Sprintf("<@%s>", receiver.ID))
+	}
+	text := fmt.Sprintf(recognitionFormat, g.Giver.ID, quantity, c.Emoji(), strings.Join(mentions, ", "))
+	for _, tag := range g.Tags {
+		text = fmt.Sprintf("%s #%s", text, tag)
+	}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		text = fmt.Sprintf("%s\n>%s", text, strings.Replace(reason, "\n", "\n>", -1))
+	}
+	return text
+}
+
+// postRecognition Post the recognition then record it through the same path as message gifts
+func postRecognition(g gift) {
+	channel, timestamp, err := g.Team.client.PostMessage(g.Channel, slack.MsgOptionText(g.Text, false))
+	if err != nil {
+		log.Printf("Unable to post recognition to channel %v with error %v\n", g.Channel, err)
+		return
+	}
+	log.Printf("Recognition posted to channel %v at %v\n", channel, timestamp)
+	g.Channel = channel
+	g.TimeStamp = timestamp
+	give(g, nil)
+}
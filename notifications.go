@@ -0,0 +1,72 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const receivedNotificationFormat = "You received %s from *%s* in <#%s>"
+const givenNotificationFormat = "You have %s left today"
+
+// notifyGift Send the direct messages the receivers and the giver opted in to.
+// received is what each receiver id got by currency name, remaining what the giver has left by currency name.
+func notifyGift(g gift, received map[string]map[string]int, remaining map[string]int) {
+	link := ""
+	permalink, err := g.Team.client.GetPermalink(&slack.PermalinkParameters{Channel: g.Channel, Ts: g.TimeStamp})
+	if err != nil {
+		log.Printf("Unable to get permalink of message %v with error %v\n", g.TimeStamp, err)
+	} else {
+		link = fmt.Sprintf(" (<%s|link>)", permalink)
+	}
+	all, _, err := readPreferences(g.Team)
+	if err != nil {
+		log.Printf("Unable to read preferences with error %v\n", err)
+	}
+	for _, receiver := range g.Receivers {
+		quantities := received[receiver.ID]
+		if len(quantities) == 0 || !all[receiver.ID].Received {
+			continue
+		}
+		text := fmt.Sprintf(receivedNotificationFormat, formatQuantities(g.Team.Config, quantities), g.Giver.Profile.RealName, g.Channel) + link
+		notify(g.Team, receiver, all[receiver.ID], text)
+	}
+	if all[g.Giver.ID].Given {
+		notify(g.Team, g.Giver, all[g.Giver.ID], fmt.Sprintf(givenNotificationFormat, formatQuantities(g.Team.Config, remaining)))
+	}
+}
+
+// notify Send a direct message to the user, scheduled after their quiet hours if they are in them
+func notify(t *team, user *slack.User, p preferences, text string) {
+	_, _, channel, err := t.client.OpenIMChannel(user.ID)
+	if err != nil {
+		log.Printf("Unable to open direct message with user %v with error %v\n", user.ID, err)
+		return
+	}
+	now := time.Now()
+	if location, err := time.LoadLocation(user.TZ); err == nil {
+		now = now.In(location)
+	}
+	if until, quiet := p.quietUntil(now); quiet {
+		err := callAPI(t, "chat.scheduleMessage", map[string]interface{}{"channel": channel, "text": text, "post_at": until.Unix()})
+		if err != nil {
+			log.Printf("Unable to schedule direct message to user %v with error %v\n", user.ID, err)
+			return
+		}
+		log.Printf("Direct message to user %v scheduled at %v\n", user.ID, until)
+		return
+	}
+	post(t, channel, text)
+}
+
+// postDirect Send a direct message to the user right away
+func postDirect(t *team, userID string, text string) {
+	_, _, channel, err := t.client.OpenIMChannel(userID)
+	if err != nil {
+		log.Printf("Unable to open direct message with user %v with error %v\n", userID, err)
+		return
+	}
+	post(t, channel, text)
+}
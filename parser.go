@@ -0,0 +1,266 @@
+package p
+
+import (
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tokenKind Kind of a token found in Slack message text
+type tokenKind int
+
+const (
+	textToken tokenKind = iota
+	userToken
+	userGroupToken
+	emojiToken
+)
+
+// token A meaningful piece of a Slack message line
+type token struct {
+	Kind tokenKind
+	// Value Plain text, user id, user group id or emoji name depending on Kind
+	Value string
+	// SkinTone Skin tone modifier of an emoji, e.g. skin-tone-2
+	SkinTone string
+}
+
+// givingLine Giving instruction parsed from one line of a message
+type givingLine struct {
+	Text       string
+	Receivers  []string
+	UserGroups []string
+	// Emoji Quantity of each currency by name
+	Emoji map[string]int
+	// Karma Quantity given with the karma syntax to each user followed by it, e.g. <@USER_ID> ++
+	Karma map[string]int
+	// Tags Company values hashtagged in the line
+	Tags []string
+}
+
+// codeFence Slack mrkdwn code block delimiter
+const codeFence = "```"
+
+// emojiPattern Compile Slack emoji pattern first for better performance
+var emojiPattern = regexp.MustCompile(`^:([a-z0-9_+'\-]+):`)
+
+// prefixQuantityPattern Compile quantity written before an emoji, e.g. "5 " or "+3 "
+var prefixQuantityPattern = regexp.MustCompile(`(?:^|\s)\+?(\d+)\s*$`)
+
+// suffixQuantityPattern Compile quantity written after an emoji, e.g. " x5"
+var suffixQuantityPattern = regexp.MustCompile(`^\s*[x×](\d+)\b`)
+
+// karmaPattern Compile karma syntax written after a mention, e.g. " ++" or " += 3"
+var karmaPattern = regexp.MustCompile(`^\s*(?:\+\+|\+=\s*(\d+))`)
+
+// skinTonePattern Compile Slack skin tone modifier pattern first for better performance
+var skinTonePattern = regexp.MustCompile(`^:(skin-tone-[2-6]):`)
+
+// parseMessage Parse Slack message text into giving instructions, one per line.
+// Code spans, code blocks, block quotes and links never count towards a gift.
+func parseMessage(cfg *Config, text string) []givingLine {
+	var lines []givingLine
+	quoted := false
+	for _, line := range strings.Split(stripCodeBlocks(text), "\n") {
+		// >>> quotes everything until the end of the message
+		if strings.HasPrefix(line, "&gt;&gt;&gt;") || strings.HasPrefix(line, ">>>") {
+			quoted = true
+		}
+		if quoted || strings.HasPrefix(line, "&gt;") || strings.HasPrefix(line, ">") {
+			log.Printf("Quoted line %v. Skip.\n", line)
+			continue
+		}
+		lines = append(lines, toGivingLine(cfg, line, tokenize(line)))
+	}
+	return lines
+}
+
+// stripCodeBlocks Remove the content of ``` code blocks while keeping the line structure
+func stripCodeBlocks(text string) string {
+	var builder strings.Builder
+	for {
+		start := strings.Index(text, codeFence)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+len(codeFence):], codeFence)
+		if end < 0 {
+			// Unclosed fence is just text
+			break
+		}
+		builder.WriteString(text[:start])
+		block := text[start+len(codeFence) : start+len(codeFence)+end]
+		builder.WriteString(strings.Repeat("\n", strings.Count(block, "\n")))
+		text = text[start+len(codeFence)+end+len(codeFence):]
+	}
+	builder.WriteString(text)
+	return builder.String()
+}
+
+// tokenize Split a single line of Slack message text into tokens
+func tokenize(line string) []token {
+	var tokens []token
+	var text strings.Builder
+	flushText := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, token{Kind: textToken, Value: text.String()})
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		switch rest[0] {
+		case '`':
+			// Inline code span, skipped entirely when closed
+			end := strings.IndexByte(rest[1:], '`')
+			if end < 0 {
+				text.WriteString(rest)
+				i = len(line)
+				continue
+			}
+			flushText()
+			i += end + 2
+			continue
+		case '<':
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				break
+			}
+			if t, ok := parseEntity(rest[1:end]); ok {
+				flushText()
+				tokens = append(tokens, t)
+			}
+			// Links, channels and special mentions never count
+			i += end + 1
+			continue
+		case ':':
+			match := emojiPattern.FindStringSubmatch(rest)
+			if match == nil || strings.HasPrefix(match[1], "skin-tone-") {
+				break
+			}
+			flushText()
+			t := token{Kind: emojiToken, Value: match[1]}
+			i += len(match[0])
+			if tone := skinTonePattern.FindStringSubmatch(line[i:]); tone != nil {
+				t.SkinTone = tone[1]
+				i += len(tone[0])
+			}
+			tokens = append(tokens, t)
+			continue
+		}
+		text.WriteByte(rest[0])
+		i++
+	}
+	flushText()
+	return tokens
+}
+
+// parseEntity Parse the content between < and > of a Slack mrkdwn entity.
+// Supported forms: <@U123>, <@U123|name>, <!subteam^S123>, <!subteam^S123|@group>
+func parseEntity(entity string) (token, bool) {
+	// Drop the optional |label part
+	if bar := strings.IndexByte(entity, '|'); bar >= 0 {
+		entity = entity[:bar]
+	}
+	switch {
+	case strings.HasPrefix(entity, "@") && len(entity) > 1:
+		return token{Kind: userToken, Value: entity[1:]}, true
+	case strings.HasPrefix(entity, "!subteam^") && len(entity) > len("!subteam^"):
+		return token{Kind: userGroupToken, Value: entity[len("!subteam^"):]}, true
+	}
+	return token{}, false
+}
+
+// toGivingLine Collect receivers and currency quantities from the tokens of a line
+func toGivingLine(cfg *Config, line string, tokens []token) givingLine {
+	result := givingLine{Text: line}
+	seen := map[string]bool{}
+	// explicit Currencies given an explicit quantity, which applies once per line
+	explicit := map[string]bool{}
+	for i, t := range tokens {
+		switch t.Kind {
+		case userToken, userGroupToken:
+			if t.Kind == userToken {
+				if karma := karmaAt(tokens, i); karma > 0 {
+					if result.Karma == nil {
+						result.Karma = map[string]int{}
+					}
+					result.Karma[t.Value] += karma
+				}
+			}
+			if seen[t.Value] {
+				continue
+			}
+			seen[t.Value] = true
+			if t.Kind == userToken {
+				result.Receivers = append(result.Receivers, t.Value)
+			} else {
+				result.UserGroups = append(result.UserGroups, t.Value)
+			}
+		case textToken:
+			for _, value := range cfg.findValuesIn(t.Value) {
+				if !containsString(result.Tags, value) {
+					result.Tags = append(result.Tags, value)
+				}
+			}
+		case emojiToken:
+			if c, ok := cfg.currencyNamed(t.Value); ok {
+				if result.Emoji == nil {
+					result.Emoji = map[string]int{}
+				}
+				quantity, ok := quantityAt(tokens, i)
+				switch {
+				case explicit[c.Name]:
+					// Repeating the emoji does not add to an explicit quantity, e.g. 5 :taco: :taco: gives 5
+				case ok:
+					explicit[c.Name] = true
+					result.Emoji[c.Name] = quantity
+				default:
+					result.Emoji[c.Name]++
+				}
+			}
+		}
+	}
+	return result
+}
+
+// karmaAt Return the karma given right after the user token at index i, or 0.
+// Supported forms: "<@USER_ID> ++" and "<@USER_ID> += 3"
+func karmaAt(tokens []token, i int) int {
+	if i+1 >= len(tokens) || tokens[i+1].Kind != textToken {
+		return 0
+	}
+	match := karmaPattern.FindStringSubmatch(tokens[i+1].Value)
+	if match == nil {
+		return 0
+	}
+	if match[1] == "" {
+		return 1
+	}
+	quantity, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return quantity
+}
+
+// quantityAt Return the explicit quantity written around the emoji token at index i, false when there is none.
+// Supported forms: "5 :taco:", "+3 :taco:" and ":taco: x5"
+func quantityAt(tokens []token, i int) (int, bool) {
+	if i > 0 && tokens[i-1].Kind == textToken {
+		if match := prefixQuantityPattern.FindStringSubmatch(tokens[i-1].Value); match != nil {
+			if quantity, err := strconv.Atoi(match[1]); err == nil && quantity > 0 {
+				return quantity, true
+			}
+		}
+	}
+	if i+1 < len(tokens) && tokens[i+1].Kind == textToken {
+		if match := suffixQuantityPattern.FindStringSubmatch(tokens[i+1].Value); match != nil {
+			if quantity, err := strconv.Atoi(match[1]); err == nil && quantity > 0 {
+				return quantity, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,176 @@
+package p
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testConfig Configuration with a taco and a rocket currency and a teamwork value, without the environment
+func testConfig() *Config {
+	return &Config{
+		DayLimit:   5,
+		Values:     []string{"teamwork"},
+		currencies: []currency{{Name: "taco", DayLimit: 5, Weight: 1}, {Name: "rocket", DayLimit: 3, Weight: 2}},
+	}
+}
+
+func TestStripCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no code", "<@U1> :taco:", "<@U1> :taco:"},
+		{"inline block", "before ```<@U1> :taco:``` after", "before  after"},
+		{"multiline block keeps lines", "<@U1> :taco:\n```\n<@U2> :taco:\n```\n<@U3> :taco:", "<@U1> :taco:\n\n\n\n<@U3> :taco:"},
+		{"two blocks", "```a``` <@U1> ```b```", " <@U1> "},
+		{"unclosed fence is text", "``` <@U1> :taco:", "``` <@U1> :taco:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := stripCodeBlocks(test.text); got != test.want {
+				t.Errorf("stripCodeBlocks(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []token
+	}{
+		{"mention and emoji", "<@U1> :taco:", []token{
+			{Kind: userToken, Value: "U1"}, {Kind: textToken, Value: " "}, {Kind: emojiToken, Value: "taco"},
+		}},
+		{"mention with name", "<@U1|jane> thanks", []token{
+			{Kind: userToken, Value: "U1"}, {Kind: textToken, Value: " thanks"},
+		}},
+		{"subteam mention", "<!subteam^S1|@devs> :taco:", []token{
+			{Kind: userGroupToken, Value: "S1"}, {Kind: textToken, Value: " "}, {Kind: emojiToken, Value: "taco"},
+		}},
+		{"subteam mention without label", "<!subteam^S1>", []token{
+			{Kind: userGroupToken, Value: "S1"},
+		}},
+		{"emoji with skin tone", ":+1::skin-tone-3: :taco:", []token{
+			{Kind: emojiToken, Value: "+1", SkinTone: "skin-tone-3"}, {Kind: textToken, Value: " "}, {Kind: emojiToken, Value: "taco"},
+		}},
+		{"lone skin tone is text", ":skin-tone-2:", []token{
+			{Kind: textToken, Value: ":skin-tone-2:"},
+		}},
+		{"code span skipped", "`<@U1> :taco:` done", []token{
+			{Kind: textToken, Value: " done"},
+		}},
+		{"unclosed code span is text", "`<@U1>", []token{
+			{Kind: textToken, Value: "`<@U1>"},
+		}},
+		{"channels, links and special mentions skipped", "<#C1|general> <https://example.com|site> <!here>", []token{
+			{Kind: textToken, Value: "  "},
+		}},
+		{"punctuation around tokens", "(<@U1>), :taco:!", []token{
+			{Kind: textToken, Value: "("}, {Kind: userToken, Value: "U1"}, {Kind: textToken, Value: "), "},
+			{Kind: emojiToken, Value: "taco"}, {Kind: textToken, Value: "!"},
+		}},
+		{"adjacent emoji", ":taco::taco:", []token{
+			{Kind: emojiToken, Value: "taco"}, {Kind: emojiToken, Value: "taco"},
+		}},
+		{"colon in text", "ratio 3:2", []token{
+			{Kind: textToken, Value: "ratio 3:2"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tokenize(test.line); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("tokenize(%q) = %+v, want %+v", test.line, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []givingLine
+	}{
+		{"one line", "<@U1> :taco:", []givingLine{
+			{Text: "<@U1> :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"line by line", "<@U1> :taco:\n<@U2> :rocket:", []givingLine{
+			{Text: "<@U1> :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+			{Text: "<@U2> :rocket:", Receivers: []string{"U2"}, Emoji: map[string]int{"rocket": 1}},
+		}},
+		{"repeated emoji", "<@U1> :taco: :taco::taco:", []givingLine{
+			{Text: "<@U1> :taco: :taco::taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 3}},
+		}},
+		{"repeated mention counted once", "<@U1>, <@U1|jane>: :taco:", []givingLine{
+			{Text: "<@U1>, <@U1|jane>: :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"several receivers and a user group", "<@U1> <@U2> <!subteam^S1|@devs> :taco:", []givingLine{
+			{Text: "<@U1> <@U2> <!subteam^S1|@devs> :taco:", Receivers: []string{"U1", "U2"}, UserGroups: []string{"S1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"skin tone currency", "<@U1> :taco::skin-tone-4:", []givingLine{
+			{Text: "<@U1> :taco::skin-tone-4:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"other emoji ignored", "<@U1> :smile:", []givingLine{
+			{Text: "<@U1> :smile:", Receivers: []string{"U1"}},
+		}},
+		{"prefix quantity", "<@U1> 3 :taco:", []givingLine{
+			{Text: "<@U1> 3 :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 3}},
+		}},
+		{"plus quantity", "<@U1> +2 :rocket:", []givingLine{
+			{Text: "<@U1> +2 :rocket:", Receivers: []string{"U1"}, Emoji: map[string]int{"rocket": 2}},
+		}},
+		{"suffix quantity", "<@U1> :taco: x4", []givingLine{
+			{Text: "<@U1> :taco: x4", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 4}},
+		}},
+		{"explicit quantity applies once per line", "<@U1> 5 :taco: :taco:", []givingLine{
+			{Text: "<@U1> 5 :taco: :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 5}},
+		}},
+		{"explicit quantity replaces repeated emoji", "<@U1> :taco: :taco: x3", []givingLine{
+			{Text: "<@U1> :taco: :taco: x3", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 3}},
+		}},
+		{"first explicit quantity wins", "<@U1> 2 :taco: 4 :taco: :rocket: x2", []givingLine{
+			{Text: "<@U1> 2 :taco: 4 :taco: :rocket: x2", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 2, "rocket": 2}},
+		}},
+		{"number glued to a word is not a quantity", "<@U1> team2 :taco:", []givingLine{
+			{Text: "<@U1> team2 :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"punctuation adjacent", "Thanks <@U1>!:taco:.", []givingLine{
+			{Text: "Thanks <@U1>!:taco:.", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"karma after a mention", "<@U1> ++ thanks <@U2>", []givingLine{
+			{Text: "<@U1> ++ thanks <@U2>", Receivers: []string{"U1", "U2"}, Karma: map[string]int{"U1": 1}},
+		}},
+		{"karma per mention", "<@U1> ++ <@U2> += 3", []givingLine{
+			{Text: "<@U1> ++ <@U2> += 3", Receivers: []string{"U1", "U2"}, Karma: map[string]int{"U1": 1, "U2": 3}},
+		}},
+		{"karma before a mention is not its karma", "++ <@U1>", []givingLine{
+			{Text: "++ <@U1>", Receivers: []string{"U1"}},
+		}},
+		{"values tagged", "<@U1> :taco: for #TeamWork and #unknown", []givingLine{
+			{Text: "<@U1> :taco: for #TeamWork and #unknown", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}, Tags: []string{"teamwork"}},
+		}},
+		{"code span never counts", "`<@U1> :taco:` <@U2>", []givingLine{
+			{Text: "`<@U1> :taco:` <@U2>", Receivers: []string{"U2"}},
+		}},
+		{"code block never counts", "```<@U1> :taco:```", []givingLine{
+			{Text: ""},
+		}},
+		{"quoted lines skipped", "&gt; <@U1> :taco:\n<@U2> :taco:", []givingLine{
+			{Text: "<@U2> :taco:", Receivers: []string{"U2"}, Emoji: map[string]int{"taco": 1}},
+		}},
+		{"block quote skips the rest", "<@U1> :taco:\n&gt;&gt;&gt; <@U2> :taco:\n<@U3> :taco:", []givingLine{
+			{Text: "<@U1> :taco:", Receivers: []string{"U1"}, Emoji: map[string]int{"taco": 1}},
+		}},
+	}
+	cfg := testConfig()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseMessage(cfg, test.text); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseMessage(%q) = %+v, want %+v", test.text, got, test.want)
+			}
+		})
+	}
+}
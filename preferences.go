@@ -0,0 +1,184 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// preferencesSheet Sheet storing notification preferences, one row per user:
+// User id, Received DM, Given DM, Quiet hours, Team
+const preferencesSheet = "Preferences"
+
+// preferencesColumns Number of columns of a preferences row
+const preferencesColumns = 5
+
+// quietHoursFormat Time of day format of quiet hours, e.g. 22:00-08:00
+const quietHoursFormat = "15:04"
+
+const settingsUsageMessage = "Usage: ```settings\n" +
+	"settings received on|off\n" +
+	"settings given on|off\n" +
+	"settings quiet 22:00-08:00|off```"
+const settingsFormat = "DM when you receive: *%s*\nDM with what is left after you give: *%s*\nQuiet hours: *%s*"
+const settingsSavedMessage = "Saved. "
+
+// preferences Notification preferences of a user. Notifications are opt-in.
+type preferences struct {
+	UserID   string
+	Received bool
+	Given    bool
+	// Quiet Quiet hours in the user's Slack timezone, empty when none
+	Quiet string
+}
+
+// quietHours Parse the quiet hours, e.g. 22:00-08:00, into minutes since midnight
+func quietHours(text string) (int, int, error) {
+	bounds := strings.Split(text, "-")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("quiet hours %v are not like 22:00-08:00", text)
+	}
+	var minutes [2]int
+	for i, bound := range bounds {
+		t, err := time.Parse(quietHoursFormat, strings.TrimSpace(bound))
+		if err != nil {
+			return 0, 0, fmt.Errorf("quiet hours %v are not like 22:00-08:00", text)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// quietUntil When the quiet hours containing now end, false when now is not in quiet hours
+func (p preferences) quietUntil(now time.Time) (time.Time, bool) {
+	if p.Quiet == "" {
+		return now, false
+	}
+	from, to, err := quietHours(p.Quiet)
+	if err != nil || from == to {
+		return now, false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	end := midnight.Add(time.Duration(to) * time.Minute)
+	switch {
+	case from < to && minute >= from && minute < to:
+		return end, true
+	case from > to && minute >= from:
+		// Quiet hours span midnight and end tomorrow
+		return end.AddDate(0, 0, 1), true
+	case from > to && minute < to:
+		return end, true
+	}
+	return now, false
+}
+
+// readPreferences Read every preferences row of the workspace with its sheet row number
+func readPreferences(t *team) (map[string]preferences, map[string]int, error) {
+	result := map[string]preferences{}
+	rowNumbers := map[string]int{}
+	response, err := sheetsService().Spreadsheets.Values.Get(t.Config.SpreadsheetID, preferencesSheet+"!A2:E").Do()
+	if err != nil {
+		return result, rowNumbers, err
+	}
+	for i, row := range response.Values {
+		cells := make([]string, preferencesColumns)
+		for j := 0; j < len(row) && j < preferencesColumns; j++ {
+			cells[j] = fmt.Sprintf("%v", row[j])
+		}
+		// Rows written before workspaces were stored belong to the SLACK_TOKEN one
+		if cells[4] != t.ID && !(cells[4] == "" && t.Legacy) {
+			continue
+		}
+		received, _ := strconv.ParseBool(cells[1])
+		given, _ := strconv.ParseBool(cells[2])
+		result[cells[0]] = preferences{UserID: cells[0], Received: received, Given: given, Quiet: cells[3]}
+		rowNumbers[cells[0]] = i + 2
+	}
+	return result, rowNumbers, nil
+}
+
+// getPreferences Preferences of the user, everything off when none are saved or they can not be read
+func getPreferences(t *team, userID string) preferences {
+	all, _, err := readPreferences(t)
+	if err != nil {
+		log.Printf("Unable to read preferences with error %v\n", err)
+	}
+	if p, ok := all[userID]; ok {
+		return p
+	}
+	return preferences{UserID: userID}
+}
+
+// savePreferences Update the row of the user or append one, unless the rows can not be read to find it
+func savePreferences(t *team, p preferences) error {
+	_, rowNumbers, err := readPreferences(t)
+	if err != nil {
+		return err
+	}
+	var valueRange sheets.ValueRange
+	valueRange.Values = append(valueRange.Values, []interface{}{p.UserID, p.Received, p.Given, p.Quiet, t.ID})
+	if rowNumber, ok := rowNumbers[p.UserID]; ok {
+		_, err = sheetsService().Spreadsheets.Values.Update(t.Config.SpreadsheetID, fmt.Sprintf("%s!A%d", preferencesSheet, rowNumber), &valueRange).ValueInputOption("RAW").Do()
+		return err
+	}
+	_, err = sheetsService().Spreadsheets.Values.Append(t.Config.SpreadsheetID, preferencesSheet+"!A2", &valueRange).ValueInputOption("RAW").Do()
+	return err
+}
+
+// handleSettings Show or change the notification preferences of the user, args follow the settings word
+func handleSettings(t *team, userID string, args []string) string {
+	p := getPreferences(t, userID)
+	for i := range args {
+		args[i] = strings.ToLower(args[i])
+	}
+	if len(args) == 0 {
+		return formatPreferences(p)
+	}
+	if len(args) != 2 {
+		return settingsUsageMessage
+	}
+	switch args[0] {
+	case "received", "given":
+		on, ok := map[string]bool{"on": true, "off": false}[args[1]]
+		if !ok {
+			return settingsUsageMessage
+		}
+		if args[0] == "received" {
+			p.Received = on
+		} else {
+			p.Given = on
+		}
+	case "quiet":
+		if args[1] == "off" {
+			p.Quiet = ""
+			break
+		}
+		if _, _, err := quietHours(args[1]); err != nil {
+			return settingsUsageMessage
+		}
+		p.Quiet = args[1]
+	default:
+		return settingsUsageMessage
+	}
+	if err := savePreferences(t, p); err != nil {
+		log.Printf("Unable to save preferences %+v with error %v\n", p, err)
+		return fmt.Sprintf("Unable to save your settings: %v", err)
+	}
+	log.Printf("Preferences saved %+v\n", p)
+	return settingsSavedMessage + formatPreferences(p)
+}
+
+// formatPreferences Render the preferences for the settings command
+func formatPreferences(p preferences) string {
+	onOff := map[bool]string{true: "on", false: "off"}
+	quiet := p.Quiet
+	if quiet == "" {
+		quiet = "off"
+	}
+	return fmt.Sprintf(settingsFormat, onOff[p.Received], onOff[p.Given], quiet)
+}
@@ -0,0 +1,22 @@
+package p
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSavePreferencesReadError(t *testing.T) {
+	var writes int
+	fakeSheets(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writes++
+			w.Write([]byte("{}"))
+			return
+		}
+		http.Error(w, `{"error": {"code": 503, "message": "unavailable"}}`, http.StatusServiceUnavailable)
+	})
+	err := savePreferences(&team{ID: "T1", Config: testConfig()}, preferences{UserID: "U1", Received: true})
+	if err == nil || writes != 0 {
+		t.Errorf("savePreferences() = %v with %d writes, want an error without write", err, writes)
+	}
+}
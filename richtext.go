@@ -0,0 +1,141 @@
+package p
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// messageBlocks Only the blocks of a message event, other fields are parsed by slackevents
+type messageBlocks struct {
+	Blocks []richTextElement `json:"blocks"`
+}
+
+// richTextElement Any block or element of a rich_text block.
+// Containers (rich_text, sections, lists, quotes) have Elements, leaves have the other fields.
+type richTextElement struct {
+	Type        string            `json:"type"`
+	Elements    []richTextElement `json:"elements"`
+	Text        string            `json:"text"`
+	UserID      string            `json:"user_id"`
+	UsergroupID string            `json:"usergroup_id"`
+	Name        string            `json:"name"`
+	SkinTone    int               `json:"skin_tone"`
+	Style       *richTextStyle    `json:"style"`
+}
+
+// richTextStyle Style of a rich text leaf element
+type richTextStyle struct {
+	Code bool `json:"code"`
+}
+
+// blocksFrom Extract the blocks of the inner event raw JSON
+func blocksFrom(rawEvent *json.RawMessage) []richTextElement {
+	if rawEvent == nil {
+		return nil
+	}
+	var message messageBlocks
+	if err := json.Unmarshal(*rawEvent, &message); err != nil {
+		log.Printf("Unable to unmarshal message blocks with error %v\n", err)
+		return nil
+	}
+	return message.Blocks
+}
+
+// parseBlocks Parse rich_text blocks into giving instructions, one per line or list item.
+// Returns false when there is no rich_text block so the caller can fall back to the message text.
+func parseBlocks(cfg *Config, blocks []richTextElement) ([]givingLine, bool) {
+	var lines [][]token
+	found := false
+	for _, block := range blocks {
+		if block.Type != "rich_text" {
+			continue
+		}
+		found = true
+		for _, element := range block.Elements {
+			lines = append(lines, walkRichText(element)...)
+		}
+	}
+	var result []givingLine
+	for _, tokens := range lines {
+		result = append(result, toGivingLine(cfg, renderTokens(tokens), tokens))
+	}
+	return result, found
+}
+
+// walkRichText Collect the token lines of a rich_text container element
+func walkRichText(element richTextElement) [][]token {
+	switch element.Type {
+	case "rich_text_section":
+		return sectionLines(element.Elements)
+	case "rich_text_list":
+		// Every list item is its own line
+		var lines [][]token
+		for _, item := range element.Elements {
+			lines = append(lines, walkRichText(item)...)
+		}
+		return lines
+	case "rich_text_quote", "rich_text_preformatted":
+		log.Printf("Skip %v element.\n", element.Type)
+		return nil
+	}
+	log.Printf("Strange rich text element %v\n", element.Type)
+	return nil
+}
+
+// sectionLines Split the leaf elements of a section into token lines on new lines
+func sectionLines(elements []richTextElement) [][]token {
+	lines := [][]token{nil}
+	appendToken := func(t token) {
+		lines[len(lines)-1] = append(lines[len(lines)-1], t)
+	}
+	for _, element := range elements {
+		if element.Style != nil && element.Style.Code {
+			continue
+		}
+		switch element.Type {
+		case "text":
+			for i, text := range strings.Split(element.Text, "\n") {
+				if i > 0 {
+					lines = append(lines, nil)
+				}
+				if text != "" {
+					appendToken(token{Kind: textToken, Value: text})
+				}
+			}
+		case "user":
+			appendToken(token{Kind: userToken, Value: element.UserID})
+		case "usergroup":
+			appendToken(token{Kind: userGroupToken, Value: element.UsergroupID})
+		case "emoji":
+			t := token{Kind: emojiToken, Value: element.Name}
+			if element.SkinTone > 0 {
+				t.SkinTone = fmt.Sprintf("skin-tone-%d", element.SkinTone)
+			}
+			appendToken(t)
+		}
+	}
+	return lines
+}
+
+// renderTokens Render tokens back to Slack message text
+func renderTokens(tokens []token) string {
+	var builder strings.Builder
+	for _, t := range tokens {
+		switch t.Kind {
+		case userToken:
+			builder.WriteString(fmt.Sprintf("<@%s>", t.Value))
+		case userGroupToken:
+			builder.WriteString(fmt.Sprintf("<!subteam^%s>", t.Value))
+		case emojiToken:
+			builder.WriteString(fmt.Sprintf(":%s:", t.Value))
+			if t.SkinTone != "" {
+				builder.WriteString(fmt.Sprintf(":%s:", t.SkinTone))
+			}
+		default:
+			builder.WriteString(t.Value)
+		}
+	}
+	return builder.String()
+}
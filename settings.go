@@ -0,0 +1,196 @@
+package p
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// settingsSheet Sheet storing settings editable without redeploying, one row per setting: Name, Value.
+// Names are environment variable names, e.g. MAX_EVERYDAY, and the values override them. Blank values are ignored.
+const settingsSheet = "Settings"
+
+// runtimeSettings Settings the sheet may change. Secrets, the spreadsheet and roles stay in the environment.
+var runtimeSettings = []string{
+	"EMOJI_NAME", "MAX_EVERYDAY", "MAX_PER_GIFT", "CURRENCIES", "SPLIT_POLICY", "KARMA_CHANNELS", "VALUES",
+	"LOCATION", "SPRINT_START_DATE", "SPRINT_DURATION",
+	"GREETING", "CHART_PAGE_SIZE", "RECOGNITION_CHANNEL",
+	"ACK_STYLE", "ACK_CHANNELS", "FEEDBACK_STYLE", "FEEDBACK_CHANNELS",
+	"FEEDBACK_SELF_GIVING", "FEEDBACK_BOT_RECEIVER", "FEEDBACK_LIMIT_REACHED", "FEEDBACK_TRIMMED",
+	"FEEDBACK_DIRECT_MESSAGE", "FEEDBACK_PRIVATE_CHANNEL", "FEEDBACK_CHANNEL_EXCLUDED",
+	"FEEDBACK_BANNED_GIVER", "FEEDBACK_BANNED_RECEIVER",
+	"ALLOWED_CHANNELS", "EXCLUDED_CHANNELS", "ALLOW_DIRECT_MESSAGES", "ALLOW_PRIVATE_CHANNELS",
+}
+
+// readSettings Read the settings of the sheet by name with their sheet row number,
+// skipping blank values and settings it may not change
+func readSettings(cfg *Config) (map[string]string, map[string]int, error) {
+	result := map[string]string{}
+	rowNumbers := map[string]int{}
+	response, err := sheetsService().Spreadsheets.Values.Get(cfg.SpreadsheetID, settingsSheet+"!A2:B").Do()
+	if isMissingSheet(err) {
+		// The sheet is optional, without it the environment applies as is
+		return result, rowNumbers, nil
+	}
+	if err != nil {
+		return result, rowNumbers, err
+	}
+	for i, row := range response.Values {
+		cells := make([]string, 2)
+		for j := 0; j < len(row) && j < len(cells); j++ {
+			cells[j] = strings.TrimSpace(fmt.Sprintf("%v", row[j]))
+		}
+		name := strings.ToUpper(cells[0])
+		if !containsString(runtimeSettings, name) {
+			if name != "" {
+				log.Printf("Skip setting %v, it can only be changed in the environment\n", name)
+			}
+			continue
+		}
+		rowNumbers[name] = i + 2
+		if cells[1] != "" {
+			result[name] = cells[1]
+		}
+	}
+	return result, rowNumbers, nil
+}
+
+// settingsVersion Short hash identifying the settings, the same settings always have the same version.
+// Empty when there is none, like the configuration of the environment alone.
+func settingsVersion(settings map[string]string) string {
+	if len(settings) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s=%s\n", name, settings[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:8]
+}
+
+// applySettings Load the configuration with the Settings sheet over the environment.
+// Returns the current configuration when the sheet is unchanged, unreadable or invalid, with the version rejected
+// so an invalid sheet is reported once rather than at every poll.
+// The version read at startup is not audited, the process did not apply another one before.
+func applySettings(base *Config, current *Config, rejected string, startup bool) (*Config, string) {
+	settings, _, err := readSettings(base)
+	if err != nil {
+		log.Printf("Unable to read settings with error %v. Keep version %v.\n", err, versionOf(current))
+		return current, rejected
+	}
+	version := settingsVersion(settings)
+	if version == current.version || version == rejected {
+		return current, rejected
+	}
+	cfg, err := loadSettings(settings)
+	if err != nil {
+		log.Printf("Rejected settings version %v, keep version %v. %v\n", version, versionOf(current), err)
+		return current, version
+	}
+	cfg.version = version
+	cfg.settings = settings
+	log.Printf("Settings version %v loaded: %v\n", version, settings)
+	if startup {
+		return cfg, ""
+	}
+	before, after := settingsChanges(current.settings, settings)
+	event := auditEvent{Actor: settingsActor, Action: "settings", Target: "version " + versionOf(cfg), Before: before, After: after}
+	background(func() { recordAudit(base, event) })
+	return cfg, ""
+}
+
+// settingsChanges Render the settings that differ between the versions with their previous and new values,
+// e.g. "MAX_EVERYDAY=5; VALUES=unset" and "MAX_EVERYDAY=10; VALUES=teamwork"
+func settingsChanges(previous map[string]string, next map[string]string) (string, string) {
+	names := map[string]bool{}
+	for name := range previous {
+		names[name] = true
+	}
+	for name := range next {
+		names[name] = true
+	}
+	var changed []string
+	for name := range names {
+		if previous[name] != next[name] {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	value := func(settings map[string]string, name string) string {
+		if value, ok := settings[name]; ok {
+			return fmt.Sprintf("%s=%s", name, value)
+		}
+		return name + "=unset"
+	}
+	var before, after []string
+	for _, name := range changed {
+		before = append(before, value(previous, name))
+		after = append(after, value(next, name))
+	}
+	return strings.Join(before, "; "), strings.Join(after, "; ")
+}
+
+// versionOf Version of the settings applied to the configuration, for logs
+func versionOf(cfg *Config) string {
+	if cfg.version == "" {
+		return "environment"
+	}
+	return cfg.version
+}
+
+// loadSettings Load the configuration with the settings over the environment
+func loadSettings(settings map[string]string) (*Config, error) {
+	return LoadConfig(os.Getenv("CONFIG_FILE"), func(name string) string {
+		if value, ok := settings[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+// saveSetting Check the configuration stays valid with the setting then update its row or append one.
+// A blank value clears the setting. Requests use it once the sheet is read again. Returns the previous value.
+func saveSetting(cfg *Config, name string, value string) (string, error) {
+	if !containsString(runtimeSettings, name) {
+		return "", fmt.Errorf("%v can only be changed in the environment", name)
+	}
+	settings, rowNumbers, err := readSettings(cfg)
+	if err != nil {
+		return "", err
+	}
+	previous := settings[name]
+	if value == "" {
+		delete(settings, name)
+	} else {
+		settings[name] = value
+	}
+	if _, err := loadSettings(settings); err != nil {
+		return previous, err
+	}
+	var valueRange sheets.ValueRange
+	valueRange.Values = append(valueRange.Values, []interface{}{name, value})
+	if rowNumber, ok := rowNumbers[name]; ok {
+		_, err = sheetsService().Spreadsheets.Values.Update(cfg.SpreadsheetID, fmt.Sprintf("%s!A%d", settingsSheet, rowNumber), &valueRange).ValueInputOption("RAW").Do()
+	} else {
+		_, err = sheetsService().Spreadsheets.Values.Append(cfg.SpreadsheetID, settingsSheet+"!A2", &valueRange).ValueInputOption("RAW").Do()
+	}
+	if err != nil {
+		return previous, err
+	}
+	activeConfig.Lock()
+	activeConfig.checked = time.Time{}
+	activeConfig.Unlock()
+	return previous, nil
+}
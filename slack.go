@@ -5,9 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,39 +12,15 @@ import (
 	"github.com/nlopes/slack/slackevents"
 )
 
-// mainEmoji name of the emoji to give
-var mainEmoji = fmt.Sprintf(":%s:", os.Getenv("EMOJI_NAME"))
-
 // dateTimeFormat Datetime format sent from Slack
 const dateTimeFormat = "01/02/2006 15:04:05"
 
-// userIDPattern Compile Slack user id pattern first for better performance
-var userIDPattern = regexp.MustCompile(`<@[\w]*>`)
-
-// mainEmojiPattern Compile Slack main emoji pattern first for better performance
-var mainEmojiPattern = regexp.MustCompile(strings.Replace(fmt.Sprintf("(%s){1}", mainEmoji), "-", "\\-", -1))
-
-// dayLimit Maximum number of emoji can be given everyday by each user
-var dayLimit, _ = strconv.Atoi(os.Getenv("MAX_EVERYDAY"))
-
-// location Location name Vietnam
-const location = "Vietnam"
-
-var greetingMessage = fmt.Sprintf("Chào anh chị em e-pilot :thuan: :mama-thuy: :tung: Xem BXH tại %s", spreadsheetURL)
-
 const noRecordMessage = "No record found! :quy-serious:"
-const invalidCommandMessage = "Invalid Command. Available commands are: ```help\nchart\nchart day\nchart week\nchart sprint\nchart month\nchart year```"
+const ledgerUnavailableMessage = "Unable to read the records right now, please try again."
+const invalidCommandMessage = "Invalid Command. Available commands are: ```help\nchart\nchart day\nchart week\nchart sprint\nchart month\nchart year\nchart <period> emoji|karma|modal|-emoji|-karma|-modal\nchart <period> <currency>|score\nchart #<value> <period>\nstats [@user] [period]```"
 
 const resultMessageFormat = "Result from %v to %v:\n%s"
 
-// sprintStart A start date of the sprint with layout dd MM yyyy
-var sprintStart, _ = time.Parse("02 01 2006", os.Getenv("SPRINT_START_DATE"))
-
-// sprintDuration Sprint Duration in day
-var sprintDuration, _ = strconv.Atoi(os.Getenv("SPRINT_DURATION"))
-
-var client = slack.New(os.Getenv("SLACK_TOKEN"))
-
 type Emoji string
 
 const (
@@ -59,31 +32,137 @@ const (
 type Duration string
 
 const (
-	Day    Duration = "Duration"
-	Week            = "Week"
-	Sprint          = "Sprint"
-	Month           = "Month"
-	Year            = "Year"
+	Day    Duration = "Day"
+	Week   Duration = "Week"
+	Sprint Duration = "Sprint"
+	Month  Duration = "Month"
+	Year   Duration = "Year"
+)
+
+// durations Supported chart durations
+var durations = []Duration{Day, Week, Sprint, Month, Year}
+
+// Source How a gift was made
+type Source string
+
+const (
+	// EmojiSource Gift made by posting the main emoji
+	EmojiSource Source = "emoji"
+	// KarmaSource Gift made with the karma syntax, e.g. @user ++
+	KarmaSource Source = "karma"
+	// ModalSource Gift made with the give modal
+	ModalSource Source = "modal"
+	// AdminSource Gift granted or limit reset with an admin command
+	AdminSource Source = "admin"
+)
+
+// sources Supported gift sources
+var sources = []Source{EmojiSource, KarmaSource, ModalSource, AdminSource}
+
+// chartQuery Filters of a chart command
+type chartQuery struct {
+	Duration Duration
+	// Sources Sources to include, all when empty
+	Sources []Source
+	// ExcludedSources Sources to leave out
+	ExcludedSources []Source
+	// Currency Name of the currency to rank, the default currency when empty
+	Currency string
+	// Score Rank by the combined weighted score of all currencies
+	Score bool
+	// Tag Company value the entries must be tagged with, any when empty
+	Tag string
+}
+
+type SplitPolicy string
+
+const (
+	// Each Every receiver on a line gets the full emoji count
+	Each SplitPolicy = "each"
+	// Split The emoji count on a line is shared between receivers
+	Split SplitPolicy = "split"
 )
 
+const selfGivingReason = "self-giving is not allowed"
+const botReceiverReason = "bots can not receive emoji"
+const bannedReceiverReason = "banned from recognition"
+const notRecordedReason = "the gift could not be recorded, please try again"
+const dailyLimitReasonFormat = "trimmed by the daily limit of %d"
+const perGiftLimitReasonFormat = "trimmed by the limit of %d per gift"
+
+// gift A giving line of a message, from one giver to receivers
+type gift struct {
+	// Team Workspace the gift is made in
+	Team *team
+	// Profile Rules of the channel the gift is made in
+	Profile   channelProfile
+	Channel   string
+	TimeStamp string
+	// Text Whole message text stored in the ledger
+	Text      string
+	Giver     *slack.User
+	Receivers []*slack.User
+	// Quantities Quantity of each currency by name
+	Quantities map[string]int
+	Source     Source
+	// Tags Company values the gift is tagged with
+	Tags []string
+}
+
+// receiverOutcome The result of giving one currency to one receiver
+type receiverOutcome struct {
+	Receiver  *slack.User
+	Currency  currency
+	Requested int
+	Given     int
+	Reason    string
+	// LimitReached Nothing was given because the giver had already reached the daily limit of the currency
+	LimitReached bool
+}
+
+func (o receiverOutcome) String() string {
+	if o.Requested == 0 {
+		return fmt.Sprintf("<@%s> skipped: %s", o.Receiver.ID, o.Reason)
+	}
+	result := fmt.Sprintf("<@%s> received %d %s", o.Receiver.ID, o.Given, o.Currency.Emoji())
+	if o.Reason != "" {
+		result = fmt.Sprintf("%s (%d %s)", result, o.Requested-o.Given, o.Reason)
+	}
+	return result
+}
+
 type Command string
 
 const (
 	Help  Command = "help"
 	Chart         = "chart"
+	Stats         = "stats"
 )
 
 // handleCallbackEvent Handle Callback events from Slack
-func handleCallbackEvent(event slackevents.EventsAPIEvent) {
+func handleCallbackEvent(cfg *Config, event slackevents.EventsAPIEvent) {
 	log.Println("Callback event")
+	callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent)
+	if !ok {
+		log.Printf("Strange callback event data %v\n", event.Data)
+		return
+	}
+	t := teamFor(cfg, callback.TeamID)
+	if t == nil {
+		return
+	}
 	switch event := event.InnerEvent.Data.(type) {
 	case *slackevents.AppMentionEvent:
 		log.Printf("AppMentionEvent %v\n", event)
-		handleAppMention(event)
+		handleAppMention(t, event)
 		return
 	case *slackevents.MessageEvent:
 		log.Printf("MessageEvent %v\n", event)
-		handleMessage(event)
+		handleMessage(t, event, blocksFrom(callback.InnerEvent))
+		return
+	case *appHomeOpenedEvent:
+		log.Printf("AppHomeOpenedEvent %v\n", event)
+		handleAppHomeOpened(t, event)
 		return
 	default:
 		log.Printf("Strange message event %v\n", event)
@@ -91,51 +170,108 @@ func handleCallbackEvent(event slackevents.EventsAPIEvent) {
 	}
 }
 
-func handleAppMention(event *slackevents.AppMentionEvent) {
+func handleAppMention(t *team, event *slackevents.AppMentionEvent) {
 	// Trim the mention part
 	// format: <@app_id> which contains 12 characters
 	text := strings.ToLower(strings.TrimSpace(event.Text[12:]))
 	// @app help
 	if Command(text) == Help || text == "" {
-		go post(event.Channel, greetingMessage)
+		greeting := channelProfileOf(t, event.Channel).greeting(t.Config)
+		background(func() { post(t, event.Channel, greeting) })
 		return
 	}
 	// @app chart <day> (default)
 	// @app chart week
 	// @app chart sprint
 	// @app chart month
+	// @app chart week karma
+	// @app chart week -karma
+	// @app chart week rocket
+	// @app chart week score
 	if strings.HasPrefix(text, Chart) {
-		from, to, err := calculateRangeFrom(text)
-		if err {
+		query, err := parseChartQuery(t.Config, text)
+		if err != nil {
+			log.Printf("Unable to parse chart query %v with error %v\n", text, err)
+			background(func() { post(t, event.Channel, invalidCommandMessage) })
+			return
+		}
+		from, to, failed := calculateRangeFrom(t.Config, query.Duration)
+		if failed {
+			return
+		}
+		records, err := getRecords(t, from, to, query)
+		if err != nil {
+			log.Printf("Unable to get chart records with error %v\n", err)
+			background(func() { post(t, event.Channel, ledgerUnavailableMessage) })
 			return
 		}
-		records := getRecords(from, to)
 		if len(records) > 0 {
-			go post(event.Channel, fmt.Sprintf(resultMessageFormat, from, to, records.String()))
+			text := chartText(t.Config, from, to, records, 0)
+			background(func() {
+				postBlocks(t, event.Channel, text, chartBlocks(t.Config, from, to, query, records, getAvatars(t), 0))
+			})
 		} else {
-			go post(event.Channel, noRecordMessage)
+			background(func() { post(t, event.Channel, noRecordMessage) })
+		}
+		return
+	}
+
+	// @app stats
+	// @app stats week
+	// @app stats @user month
+	if strings.HasPrefix(text, Stats) {
+		query, err := parseChartQuery(t.Config, text)
+		if err != nil {
+			log.Printf("Unable to parse stats query %v with error %v\n", text, err)
+			background(func() { post(t, event.Channel, invalidCommandMessage) })
+			return
+		}
+		from, to, failed := calculateRangeFrom(t.Config, query.Duration)
+		if failed {
+			return
+		}
+		receiverName := ""
+		// Mentions are case sensitive so look for them in the original text
+		if ids := parseMessage(t.Config, event.Text[12:]); len(ids) > 0 && len(ids[0].Receivers) > 0 {
+			receiver, err := t.client.GetUserInfo(ids[0].Receivers[0])
+			if err != nil {
+				log.Printf("Unable to get stats user %v info with error %v\n", ids[0].Receivers[0], err)
+				return
+			}
+			receiverName = receiver.Profile.RealName
+		}
+		stats, err := getStats(t, from, to, query, receiverName)
+		if err != nil {
+			log.Printf("Unable to get stats with error %v\n", err)
+			background(func() { post(t, event.Channel, ledgerUnavailableMessage) })
+			return
+		}
+		if len(stats) > 0 {
+			background(func() { post(t, event.Channel, fmt.Sprintf(resultMessageFormat, from, to, formatStats(stats))) })
+		} else {
+			background(func() { post(t, event.Channel, noRecordMessage) })
 		}
 		return
 	}
 
 	log.Println("Strange App Mention Event")
-	go post(event.Channel, invalidCommandMessage)
+	background(func() { post(t, event.Channel, invalidCommandMessage) })
 }
 
-//	calculateRangeFrom Calculate the range from duration text
-func calculateRangeFrom(text string) (Date, Date, bool) {
-	year, month, day := timeIn(location, time.Now()).Date()
+//	calculateRangeFrom Calculate the range from duration
+func calculateRangeFrom(cfg *Config, duration Duration) (Date, Date, bool) {
+	now := cfg.now()
+	year, month, day := now.Date()
 	today := Date{year, month, day}
 	var from Date
 	to := today
 
-	duration := durationFrom(text)
 	switch duration {
 	case Day:
 		from = today
 		break
 	case Week:
-		date := timeIn(location, time.Now())
+		date := now
 		// Iterate back to first day of the week, assuming it's Monday
 		for date.Weekday() != time.Monday {
 			date = date.AddDate(0, 0, -1)
@@ -143,13 +279,8 @@ func calculateRangeFrom(text string) (Date, Date, bool) {
 		from = Date{date.Year(), date.Month(), date.Day()}
 		break
 	case Sprint:
-		sprintEnd := sprintStart.AddDate(0, 0, sprintDuration).Add(-1)
-		duringSprint := timeIn(location, time.Now()).After(sprintStart) && timeIn(location, time.Now()).Before(sprintEnd)
-		for !duringSprint {
-			sprintStart = sprintEnd.Add(1)
-			sprintEnd = sprintStart.AddDate(0, 0, sprintDuration).Add(-1)
-		}
-		from = Date{sprintStart.Year(), sprintStart.Month(), sprintStart.Day()}
+		start := cfg.currentSprintStart(now)
+		from = Date{start.Year(), start.Month(), start.Day()}
 		break
 	case Month:
 		from = Date{year, month, 1}
@@ -163,74 +294,257 @@ func calculateRangeFrom(text string) (Date, Date, bool) {
 	return from, to, false
 }
 
-func durationFrom(text string) Duration {
-	result := Day
-	slices := strings.Split(text, " ")
-	if len(slices) == 2 {
-		result = Duration(slices[1])
+// parseChartQuery Parse the arguments of a chart command, e.g. "chart week -karma"
+func parseChartQuery(cfg *Config, text string) (chartQuery, error) {
+	query := chartQuery{Duration: Day}
+	for _, arg := range strings.Fields(text)[1:] {
+		// Mentions are handled by the command
+		if strings.HasPrefix(arg, "<@") {
+			continue
+		}
+		if strings.HasPrefix(arg, "#") {
+			value, ok := cfg.valueNamed(arg)
+			if !ok {
+				return query, fmt.Errorf("unknown company value %v", arg)
+			}
+			query.Tag = value
+			continue
+		}
+		if duration, ok := durationNamed(arg); ok {
+			query.Duration = duration
+			continue
+		}
+		if arg == "score" {
+			query.Score = true
+			continue
+		}
+		if c, ok := cfg.currencyNamed(arg); ok {
+			query.Currency = c.Name
+			continue
+		}
+		if source, ok := sourceNamed(strings.TrimPrefix(arg, "-")); ok {
+			if strings.HasPrefix(arg, "-") {
+				query.ExcludedSources = append(query.ExcludedSources, source)
+			} else {
+				query.Sources = append(query.Sources, source)
+			}
+			continue
+		}
+		return query, fmt.Errorf("unknown chart argument %v", arg)
 	}
-	log.Printf("Param: %v\n", result)
-	return result
+	log.Printf("Chart query: %+v\n", query)
+	return query, nil
+}
+
+// durationNamed Find the duration with the case insensitive name
+func durationNamed(name string) (Duration, bool) {
+	for _, duration := range durations {
+		if strings.EqualFold(name, string(duration)) {
+			return duration, true
+		}
+	}
+	return "", false
+}
+
+// sourceNamed Find the source with the case insensitive name
+func sourceNamed(name string) (Source, bool) {
+	for _, source := range sources {
+		if strings.EqualFold(name, string(source)) {
+			return source, true
+		}
+	}
+	return "", false
+}
+
+// value Weighted quantity of the entry in the chart, counting the weight of the channel it was given in
+func (q chartQuery) value(cfg *Config, entry ledgerEntry) int {
+	return entry.Quantity * entry.Weight * q.weight(cfg, entry.Currency)
+}
+
+// weight Weight of an entry of the currency in the chart, 0 when the currency is not part of it
+func (q chartQuery) weight(cfg *Config, currencyName string) int {
+	c, ok := cfg.currencyNamed(currencyName)
+	if !ok {
+		return 0
+	}
+	if q.Score {
+		return c.Weight
+	}
+	if q.Currency == c.Name || (q.Currency == "" && c.Name == cfg.defaultCurrency().Name) {
+		return 1
+	}
+	return 0
 }
 
-func handleMessage(messageEvent *slackevents.MessageEvent) {
-	if !verifyMessageEvent(messageEvent) {
+// matches Whether the ledger entry is part of the chart in range
+func (q chartQuery) matches(cfg *Config, entry ledgerEntry, from Date, to Date) bool {
+	if !entry.Adjustment.ranks() || q.weight(cfg, entry.Currency) == 0 || !isInRange(entry.Time, from, to) || !q.includes(entry.Source) {
+		return false
+	}
+	return q.Tag == "" || containsString(entry.Tags, q.Tag)
+}
+
+// includes Whether entries from the source are part of the chart
+func (q chartQuery) includes(source Source) bool {
+	for _, excluded := range q.ExcludedSources {
+		if source == excluded {
+			return false
+		}
+	}
+	if len(q.Sources) == 0 {
+		return true
+	}
+	for _, included := range q.Sources {
+		if source == included {
+			return true
+		}
+	}
+	return false
+}
+
+// isKarmaChannel Whether the karma syntax is enabled in the channel
+func (cfg *Config) isKarmaChannel(channel string) bool {
+	return containsString(cfg.KarmaChannels, channel)
+}
+
+// handleMessage Handle message using its rich_text blocks, falling back to the message text
+func handleMessage(t *team, messageEvent *slackevents.MessageEvent, blocks []richTextElement) {
+	if !verifyMessageEvent(t, messageEvent) {
 		return
 	}
 	log.Printf("Message text: %v\n", messageEvent.Text)
+	lines, found := parseBlocks(t.Config, blocks)
+	if !found {
+		log.Println("No rich text blocks. Parse message text.")
+		lines = parseMessage(t.Config, messageEvent.Text)
+	}
 	//	Line by line
-	for _, row := range strings.Split(messageEvent.Text, "\n") {
-		log.Printf("Processing row: %s\n", row)
-		go processMessageText(messageEvent, row)
+	for _, line := range lines {
+		line := line
+		log.Printf("Processing line: %s\n", line.Text)
+		background(func() { processMessageText(t, messageEvent, line) })
 	}
 	log.Println("Finish handling MessageEvent")
 }
 
-// processMessageText Process by custom text instead of entire message
-func processMessageText(event *slackevents.MessageEvent, text string) {
-	numEmoji := len(mainEmojiPattern.FindAllString(text, -1))
-	log.Printf("Matched emoji %v in text %v\n", numEmoji, text)
-	if numEmoji == 0 {
-		log.Printf("No emoji %v found in message %v. Return.\n", mainEmoji, text)
+// processMessageText Process a parsed line instead of entire message
+func processMessageText(t *team, event *slackevents.MessageEvent, line givingLine) {
+	cfg := t.Config
+	log.Printf("Matched emoji %v in text %v\n", line.Emoji, line.Text)
+	if len(line.Emoji) == 0 && len(line.Karma) > 0 && cfg.isKarmaChannel(event.Channel) {
+		log.Printf("Matched karma %v in text %v\n", line.Karma, line.Text)
+		for _, karmaLine := range karmaLines(line) {
+			processGift(t, event, karmaLine, map[string]int{cfg.defaultCurrency().Name: karmaLine.Karma[karmaLine.Receivers[0]]}, KarmaSource)
+		}
 		return
 	}
+	processGift(t, event, line, line.Emoji, EmojiSource)
+}
 
-	// Find the receiver
-	receiverID := findFirstUserIdIn(text)
-	if receiverID == "" {
-		log.Printf("No receiver found. Return.\n")
+// karmaLines Split the line into one line per karma quantity, with only the users followed by it as receivers.
+// Other mentions of the line receive nothing, e.g. <@A> ++ thanks <@B> only gives to A.
+func karmaLines(line givingLine) []givingLine {
+	var result []givingLine
+	byQuantity := map[int]int{}
+	for _, receiver := range line.Receivers {
+		karma := line.Karma[receiver]
+		if karma <= 0 {
+			continue
+		}
+		i, ok := byQuantity[karma]
+		if !ok {
+			i = len(result)
+			byQuantity[karma] = i
+			result = append(result, givingLine{Text: line.Text, Karma: line.Karma, Tags: line.Tags})
+		}
+		result[i].Receivers = append(result[i].Receivers, receiver)
+	}
+	return result
+}
+
+// processGift Give the quantities of the line from the author of the message to its receivers
+func processGift(t *team, event *slackevents.MessageEvent, line givingLine, quantities map[string]int, source Source) {
+	cfg := t.Config
+	if len(quantities) == 0 {
+		log.Printf("No emoji %v found in message %v. Return.\n", cfg.currencies, line.Text)
 		return
 	}
-	receiver, err := client.GetUserInfo(receiverID)
-	if err != nil {
-		log.Panicf("Error getting receiver %v info %v\n", receiverID, err)
+	profile := channelProfileOf(t, event.Channel)
+	if profile.Disabled {
+		log.Printf("Gifts are disabled in channel %v. Return.\n", event.Channel)
+		return
+	}
+	for name := range quantities {
+		if !profile.accepts(name) {
+			log.Printf("Currency %v is not accepted in channel %v. Skip.\n", name, event.Channel)
+			delete(quantities, name)
+		}
+	}
+	if len(quantities) == 0 {
 		return
 	}
-	printUserInfo(receiver)
 
-	//	Human only, bitch!
-	if receiver.IsBot {
-		log.Printf("Receiver %v is bot. Return.\n", receiver.Profile.RealName)
-		go react(event.Channel, event.TimeStamp, string(NotAllow))
+	// Find the receivers
+	receiverIDs := expandReceivers(t, line)
+	if len(receiverIDs) == 0 {
+		log.Printf("No receiver found. Return.\n")
 		return
 	}
 
 	// Find the giver who posted the message
-	giver, err := client.GetUserInfo(event.User)
+	giver, err := t.client.GetUserInfo(event.User)
 	if err != nil {
-		log.Panicf("Error getting giver %v info %v\n", event.User, err)
+		log.Printf("Error getting giver %v info %v\n", event.User, err)
 		return
 	}
 	printUserInfo(giver)
 
-	// Won't accept users giving for themself
-	if giver.ID == receiver.ID {
-		log.Printf("User with id %v is self-giving. Return.\n", giver.ID)
-		go react(event.Channel, event.TimeStamp, string(Pray))
-		return
+	var receivers []*slack.User
+	var outcomes []receiverOutcome
+	for _, receiverID := range receiverIDs {
+		receiver, err := t.client.GetUserInfo(receiverID)
+		if err != nil {
+			log.Printf("Error getting receiver %v info %v\n", receiverID, err)
+			return
+		}
+		printUserInfo(receiver)
+
+		//	Human only, bitch!
+		if receiver.IsBot {
+			log.Printf("Receiver %v is bot. Skip.\n", receiver.Profile.RealName)
+			outcomes = append(outcomes, receiverOutcome{Receiver: receiver, Reason: botReceiverReason})
+			continue
+		}
+		// Won't accept users giving for themself
+		if giver.ID == receiver.ID {
+			log.Printf("User with id %v is self-giving. Skip.\n", giver.ID)
+			outcomes = append(outcomes, receiverOutcome{Receiver: receiver, Reason: selfGivingReason})
+			continue
+		}
+		receivers = append(receivers, receiver)
 	}
 
-	go give(event, giver, receiver, numEmoji)
+	g := gift{
+		Team:       t,
+		Profile:    profile,
+		Channel:    event.Channel,
+		TimeStamp:  event.TimeStamp,
+		Text:       event.Text,
+		Giver:      giver,
+		Receivers:  receivers,
+		Quantities: quantities,
+		Source:     source,
+		Tags:       line.Tags,
+	}
+	if len(receivers) == 0 {
+		background(func() {
+			explain(t, event.Channel, giver.ID, feedbackLines(cfg, outcomes, quantitiesEmoji(cfg, quantities), nil))
+		})
+		// Rejections follow the acknowledgment style of the channel like gifts do
+		background(func() { acknowledge(g, outcomes, nil, false, false, nil) })
+		return
+	}
+	background(func() { give(g, outcomes) })
 	return
 }
 
@@ -239,16 +553,28 @@ func printUserInfo(user *slack.User) {
 	log.Printf("Slack User { ID: %v, Fullname: %v, Email: %v }\n", user.ID, user.Profile.RealName, user.Profile.Email)
 }
 
-// findFirstUserIdIn Find first user id in text message
-func findFirstUserIdIn(text string) string {
-	ids := userIDPattern.FindAllString(text, -1)
-	log.Printf("Matched ids %v\n", ids)
-	if len(ids) == 0 {
-		return ""
+// expandReceivers Return the mentioned user ids followed by the members of mentioned user groups, without duplicates
+func expandReceivers(t *team, line givingLine) []string {
+	ids := append([]string(nil), line.Receivers...)
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, group := range line.UserGroups {
+		members, err := t.client.GetUserGroupMembers(group)
+		if err != nil {
+			log.Printf("Unable to get members of user group %v with error %v\n", group, err)
+			continue
+		}
+		for _, member := range members {
+			if !seen[member] {
+				seen[member] = true
+				ids = append(ids, member)
+			}
+		}
 	}
-	var firstUser = ids[0]
-	// Slack user format: <@USER_ID>
-	return firstUser[2 : len(firstUser)-1]
+	log.Printf("Receiver ids %v\n", ids)
+	return ids
 }
 
 // handleURLVerificationEvent Response to Slack's URL verification challenge
@@ -258,40 +584,58 @@ func handleURLVerificationEvent(body string, w http.ResponseWriter) {
 	err := json.Unmarshal([]byte(body), &response)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Fatalf("Unable to unmarshal slack URL verification challenge. Error %v\n", err)
+		log.Printf("Unable to unmarshal slack URL verification challenge. Error %v\n", err)
+		return
 	}
 	w.Header().Set("Content-Type", "text")
 	numWrittenBytes, err := w.Write([]byte(response.Challenge))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Fatalf("Unable to write response challenge with error %v\n", err)
+		log.Printf("Unable to write response challenge with error %v\n", err)
+		return
 	}
 	log.Printf("%v bytes of Slack challenge response written\n", numWrittenBytes)
 }
 
 // verifyMessageEvent Check whether the message event is valid for processing
-func verifyMessageEvent(event *slackevents.MessageEvent) bool {
+func verifyMessageEvent(t *team, event *slackevents.MessageEvent) bool {
 	if event.SubType != "" {
 		log.Printf("Event with subtype %v. Return.\n", event.SubType)
 		return false
 	}
+	// Including recognitions posted by this app
+	if event.BotID != "" {
+		log.Printf("Message from bot %v. Return.\n", event.BotID)
+		return false
+	}
 	// TODO: Maybe handle edited messages someday ;)
 	if event.IsEdited() {
 		log.Printf("Edited message. Return.\n")
 		return false
 	}
-	//	Must at least contains <@USER_ID><space>:<mainEmoji>:<space>
-	if len(event.Text) < len(mainEmoji)+16 {
+	//	Must at least contains <@USER_ID><space>:<emoji>:<space>
+	minLength := len(t.Config.shortestEmoji()) + 16
+	if t.Config.isKarmaChannel(event.Channel) {
+		//	or <@USER_ID><space>++
+		minLength = 14
+	}
+	if len(event.Text) < minLength {
 		log.Printf("Message too short. Return.\n")
 		return false
 	}
+	if feedback := t.Config.channelPolicyFeedback(event.Channel, event.ChannelType); feedback != "" {
+		log.Printf("Gifts do not count in %v channel %v. Return.\n", event.ChannelType, event.Channel)
+		if containsGift(t.Config, event.Text) {
+			background(func() { explain(t, event.Channel, event.User, []string{feedback}) })
+		}
+		return false
+	}
 	return true
 }
 
 // post Post message to Slack
-func post(channel string, text string) {
+func post(t *team, channel string, text string) {
 	var msgOptionText = slack.MsgOptionText(text, true)
-	respChannel, respTimestamp, err := client.PostMessage(channel, msgOptionText)
+	respChannel, respTimestamp, err := t.client.PostMessage(channel, msgOptionText)
 	if err != nil {
 		log.Printf("Unable to post message to Slack with error %v\n", err)
 		return
@@ -299,10 +643,20 @@ func post(channel string, text string) {
 	log.Printf("Message posted to channel %v at %v\n", respChannel, respTimestamp)
 }
 
+// postInThread Post message as a reply in the thread of the message with the timestamp
+func postInThread(t *team, channel string, threadTimestamp string, text string) {
+	respChannel, respTimestamp, err := t.client.PostMessage(channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTimestamp))
+	if err != nil {
+		log.Printf("Unable to post thread reply to Slack with error %v\n", err)
+		return
+	}
+	log.Printf("Thread reply posted to channel %v at %v\n", respChannel, respTimestamp)
+}
+
 // react React to Slack message
-func react(channel string, timestamp string, emoji string) {
+func react(t *team, channel string, timestamp string, emoji string) {
 	refToMessage := slack.NewRefToMessage(channel, timestamp)
-	err := client.AddReaction(emoji, refToMessage)
+	err := t.client.AddReaction(emoji, refToMessage)
 	if err != nil {
 		log.Printf("Unable to react %v to comment %v with error %v\n", emoji, refToMessage, err)
 		return
@@ -310,98 +664,233 @@ func react(channel string, timestamp string, emoji string) {
 	log.Printf("Reacted %v to message with timestamp %v in channel %v\n", emoji, timestamp, channel)
 }
 
-func give(event *slackevents.MessageEvent, giver *slack.User, receiver *slack.User, numToGive int) {
-	giverRealName := giver.Profile.RealName
-	givingSummaries := readRow(givingSummaryReadRange)
-	// TODO: Filter by year first
-	// maybe even month and then day
-	// for better performance
-	for _, row := range givingSummaries {
-		// Skip Grand Total row
-		if strings.Contains(fmt.Sprintf("%s %s %s %s", row[0], row[1], row[2], row[3]), "Grand Total") {
-			log.Println("Grand Total row. Skip.")
-			break
-		}
-		givingSummary := givingSummary{row[0].(string), fmt.Sprintf("%s %s", row[1], row[2]), row[3].(string)}
-		log.Printf("Giving summary: %v, today: %v\n", givingSummary, today)
-		//	TODO: Use user id instead of real name since real name can be changed
-		givenToday := giverRealName == givingSummary.Name && givingSummary.Date == today
-		if givenToday {
-			log.Printf("Today record for user %v found.\n", giverRealName)
-			numGivenToday, err := strconv.Atoi(givingSummary.Total)
-			if err != nil {
-				log.Panicf("%v can not be convert to int\n", givingSummary.Total)
-				return
+// give Give emoji of each currency from giver to receivers within the giver's daily limits
+func give(g gift, outcomes []receiverOutcome) {
+	cfg := g.Team.Config
+	giverRealName := g.Giver.Profile.RealName
+	entries, err := readLedger(g.Team)
+	if err != nil {
+		log.Printf("Unable to read the ledger with error %v. Return.\n", err)
+		background(func() { explain(g.Team, g.Channel, g.Giver.ID, []string{ledgerUnavailableMessage}) })
+		return
+	}
+	if isBanned(entries, g.Giver.ID) {
+		log.Printf("User %s is banned. Return.\n", giverRealName)
+		lines := []string{renderFeedback(cfg.Feedback.BannedGiver, map[string]string{"emoji": quantitiesEmoji(cfg, g.Quantities)})}
+		background(func() { explain(g.Team, g.Channel, g.Giver.ID, lines) })
+		return
+	}
+	var receivers []*slack.User
+	for _, receiver := range g.Receivers {
+		if isBanned(entries, receiver.ID) {
+			log.Printf("Receiver %s is banned. Skip.\n", receiver.Profile.RealName)
+			outcomes = append(outcomes, receiverOutcome{Receiver: receiver, Reason: bannedReceiverReason})
+			continue
+		}
+		receivers = append(receivers, receiver)
+	}
+	g.Receivers = receivers
+	givenToday := givenTodayIn(cfg, entries, giverRealName)
+	log.Printf("Given today %v by user %v.\n", givenToday, giverRealName)
+	given := map[string]int{}
+	trimmed := false
+	var reached []currency
+	received := map[string]map[string]int{}
+	remaining := map[string]int{}
+	for _, c := range cfg.currencies {
+		// The channel profile may override the daily limit
+		c.DayLimit = g.Profile.dayLimit(c)
+		remaining[c.Name] = c.DayLimit - givenToday[c.Name]
+		numEmoji := g.Quantities[c.Name]
+		if numEmoji == 0 || len(g.Receivers) == 0 {
+			continue
+		}
+		numGivenToday := givenToday[c.Name]
+		remainingToGiveToday := c.DayLimit - numGivenToday
+		if remainingToGiveToday < 0 {
+			remainingToGiveToday = 0
+		}
+		requested, allocated, byDayLimit := allocate(cfg, numEmoji, len(g.Receivers), remainingToGiveToday)
+		if remainingToGiveToday == 0 {
+			log.Printf("User %s already gave %d %s today (maximum allowed: %d). Skip.\n", giverRealName, numGivenToday, c.Name, c.DayLimit)
+			reached = append(reached, c)
+			for i, receiver := range g.Receivers {
+				outcomes = append(outcomes, receiverOutcome{
+					Receiver:     receiver,
+					Currency:     c,
+					Requested:    requested[i],
+					Reason:       fmt.Sprintf(dailyLimitReasonFormat, c.DayLimit),
+					LimitReached: true,
+				})
 			}
-			if numGivenToday >= dayLimit {
-				log.Printf("User %s already gave %d today (maximum allowed: %d). Return.\n", givingSummary.Name, numGivenToday, dayLimit)
-				go react(event.Channel, event.TimeStamp, string(NoGood))
-				return
+			continue
+		}
+		log.Printf("Currency: %s, can be given today: %d, maximum to give per day: %d,"+
+			" user has given today: %d, want to give now: %v, giving: %v\n",
+			c.Name, remainingToGiveToday, c.DayLimit, numGivenToday, requested, allocated)
+
+		for i, receiver := range g.Receivers {
+			if allocated[i] > 0 {
+				if err := record(g, receiver, allocated[i], c); err != nil {
+					log.Printf("Unable to record gift to %v with error %v\n", receiver.ID, err)
+					allocated[i] = 0
+					byDayLimit[i] = false
+					outcomes = append(outcomes, receiverOutcome{Receiver: receiver, Currency: c, Requested: requested[i], Reason: notRecordedReason})
+					continue
+				}
 			}
-			remainingToGiveToday := dayLimit - numGivenToday
-			if numToGive > remainingToGiveToday {
-				numToGive = remainingToGiveToday
+			outcome := receiverOutcome{Receiver: receiver, Currency: c, Requested: requested[i], Given: allocated[i]}
+			if allocated[i] < requested[i] {
+				trimmed = true
+				if byDayLimit[i] {
+					outcome.Reason = fmt.Sprintf(dailyLimitReasonFormat, c.DayLimit)
+				} else {
+					outcome.Reason = fmt.Sprintf(perGiftLimitReasonFormat, cfg.MaxPerGift)
+				}
 			}
-			log.Printf("Can be given today: %d, maximum to give per day: %d,"+
-				" user has given today: %d, want to give now: %d\n",
-				remainingToGiveToday, dayLimit, numGivenToday, numToGive)
-			if numToGive > 0 {
-				record(event, giver, receiver, numToGive)
-			} else {
-				go react(event.Channel, event.TimeStamp, string(NotAllow))
+			outcomes = append(outcomes, outcome)
+			if allocated[i] > 0 {
+				given[c.Name] += allocated[i]
+				remaining[c.Name] -= allocated[i]
+				if received[receiver.ID] == nil {
+					received[receiver.ID] = map[string]int{}
+				}
+				received[receiver.ID][c.Name] += allocated[i]
 			}
-			return
 		}
 	}
-	// Haven't give today
-	log.Printf("No record found today %v for user %v. Let he/she give at most %v.\n", today, giverRealName, dayLimit)
-	if numToGive >= dayLimit {
-		numToGive = dayLimit
+
+	if len(given) > 0 {
+		background(func() { refreshHomes(g) })
+		background(func() { notifyGift(g, received, remaining) })
+	}
+	background(func() { acknowledge(g, outcomes, given, len(reached) > 0, trimmed, remaining) })
+	background(func() {
+		explain(g.Team, g.Channel, g.Giver.ID, feedbackLines(cfg, outcomes, quantitiesEmoji(cfg, g.Quantities), reached))
+	})
+}
+
+// quantitiesEmoji Emoji of the currencies in the quantities, e.g. ":taco: :rocket:"
+func quantitiesEmoji(cfg *Config, quantities map[string]int) string {
+	var emoji []string
+	for _, c := range cfg.currencies {
+		if quantities[c.Name] > 0 {
+			emoji = append(emoji, c.Emoji())
+		}
+	}
+	return strings.Join(emoji, " ")
+}
+
+// givenTodayIn Count the number of emoji of each currency given today by the giver in the entries
+func givenTodayIn(cfg *Config, entries []ledgerEntry, giverRealName string) map[string]int {
+	year, month, day := cfg.now().Date()
+	today := Date{year, month, day}
+	result := map[string]int{}
+	//	TODO: Use user id instead of real name since real name can be changed
+	for _, entry := range entries {
+		if entry.Giver == giverRealName && entry.Adjustment.spendsAllowance() && isInRange(entry.Time, today, today) {
+			result[entry.Currency] += entry.Quantity
+		}
+	}
+	return result
+}
+
+// allocate Calculate the quantity requested and granted for each receiver following the split policy,
+// and whether the daily limit rather than the maximum per gift is what trimmed each gift.
+// Each gift is capped by the maximum per gift, then receivers are served in order until the remaining allowance runs out.
+func allocate(cfg *Config, numEmoji int, numReceivers int, remaining int) ([]int, []int, []bool) {
+	requested := make([]int, numReceivers)
+	given := make([]int, numReceivers)
+	byDayLimit := make([]bool, numReceivers)
+	for i := range requested {
+		switch cfg.SplitPolicy {
+		case Split:
+			requested[i] = numEmoji / numReceivers
+			if i < numEmoji%numReceivers {
+				requested[i]++
+			}
+		default:
+			requested[i] = numEmoji
+		}
+	}
+	for i := range given {
+		given[i] = requested[i]
+		if cfg.MaxPerGift > 0 && given[i] > cfg.MaxPerGift {
+			given[i] = cfg.MaxPerGift
+		}
+		if given[i] > remaining {
+			given[i] = remaining
+			byDayLimit[i] = true
+		}
+		remaining -= given[i]
 	}
-	record(event, giver, receiver, numToGive)
+	return requested, given, byDayLimit
 }
 
-// record Record giving for  giver
-func record(event *slackevents.MessageEvent, giver *slack.User, receiver *slack.User, numToGive int) {
-	log.Printf("Record giving now for user %v, receiver %v, number %v\n", giver, receiver, numToGive)
-	write(event.Text, event.TimeStamp, giver, receiver, numToGive)
-	emoji := getNumberEmoji(numToGive)
-	for _, e := range emoji {
-		go react(event.Channel, event.TimeStamp, e)
+// replyOutcomes Reply the outcome of each receiver in the message thread
+func replyOutcomes(t *team, channel string, timestamp string, outcomes []receiverOutcome) {
+	var lines []string
+	for _, outcome := range outcomes {
+		lines = append(lines, outcome.String())
 	}
+	postInThread(t, channel, timestamp, strings.Join(lines, "\n"))
+}
+
+// record Record giving for giver
+func record(g gift, receiver *slack.User, numToGive int, c currency) error {
+	log.Printf("Record giving now for user %v, receiver %v, number %v, currency %v, source %v\n", g.Giver, receiver, numToGive, c.Name, g.Source)
+	return write(g, receiver, numToGive, c)
 }
 
-// write Write value to Google Sheets
-func write(message string, timestamp string, giver *slack.User, receiver *slack.User, toGive int) {
-	go appendRow(prepareRecord(timestamp, giver, receiver, toGive, message))
+// write Write value to Google Sheets, synchronously so the homes refreshed after giving see it
+func write(g gift, receiver *slack.User, toGive int, c currency) error {
+	row, err := prepareRecord(g, receiver, toGive, c)
+	if err != nil {
+		return err
+	}
+	return appendRow(g.Team.Config, row)
 }
 
-func prepareRecord(strTimestamp string, giver *slack.User, receiver *slack.User, toGive int, message string) []interface{} {
-	// Timestamp, Giver, Receiver, Quantity, Text, Date timestamp
+func prepareRecord(g gift, receiver *slack.User, toGive int, c currency) ([]interface{}, error) {
+	// Timestamp, Date timestamp, Giver, Receiver, Quantity, Text, Source, Currency, Tags, Team, Weight, Channel, Message, Adjustment,
+	// Giver id, Receiver id
 	// Format from Slack: 1547921475.007300
-	var timestamp = timeIn(location, toDate(strings.Split(strTimestamp, ".")[0]))
+	date, err := toDate(strings.Split(g.TimeStamp, ".")[0])
+	if err != nil {
+		return nil, err
+	}
+	var timestamp = date.In(g.Team.Config.location)
 	// Using Google Sheets recognizable format
 	var datetime = timestamp.Format(dateTimeFormat)
-	var giverRealName = giver.Profile.RealName
+	var giverRealName = g.Giver.Profile.RealName
 	var receiverRealName = receiver.Profile.RealName
-	row := []interface{}{timestamp, datetime, giverRealName, receiverRealName, toGive, message}
+	var tags = strings.Join(g.Tags, " ")
+	row := []interface{}{timestamp, datetime, giverRealName, receiverRealName, toGive, g.Text, string(g.Source), c.Name, tags, g.Team.ID, g.Profile.weight(), g.Channel, messageID(g.TimeStamp), "",
+		g.Giver.ID, receiver.ID}
 	log.Printf("Value to write %v\n", row)
-	return row
+	return row, nil
 }
 
-func parseEvent(body string, w http.ResponseWriter) bool {
-	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionVerifyToken(&slackevents.TokenComparator{VerificationToken: os.Getenv("VERIFICATION_TOKEN")}))
+func parseEvent(cfg *Config, body string, w http.ResponseWriter) bool {
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionVerifyToken(&slackevents.TokenComparator{VerificationToken: cfg.VerificationToken}))
 	if err != nil {
 		return false
 	}
 	log.Printf("Event: %v\n", event)
-	switch event.Type {
-	case slackevents.URLVerification:
+	if event.Type == slackevents.URLVerification {
 		handleURLVerificationEvent(body, w)
-		break
-	case slackevents.CallbackEvent:
-		handleCallbackEvent(event)
-		break
+		return true
 	}
+	dispatchEvent(cfg, event)
 	return true
 }
+
+// dispatchEvent Handle an Events API event received over HTTP or Socket Mode
+func dispatchEvent(cfg *Config, event slackevents.EventsAPIEvent) {
+	switch event.Type {
+	case slackevents.CallbackEvent:
+		handleCallbackEvent(cfg, event)
+	default:
+		log.Printf("Strange event type %v\n", event.Type)
+	}
+}
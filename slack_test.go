@@ -0,0 +1,83 @@
+package p
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         SplitPolicy
+		maxPerGift     int
+		numEmoji       int
+		numReceivers   int
+		remaining      int
+		wantRequested  []int
+		wantGiven      []int
+		wantByDayLimit []bool
+	}{
+		{"within limits", Each, 0, 2, 2, 5, []int{2, 2}, []int{2, 2}, []bool{false, false}},
+		{"trimmed by the per gift limit", Each, 3, 5, 1, 10, []int{5}, []int{3}, []bool{false}},
+		{"trimmed by the daily limit", Each, 0, 5, 1, 2, []int{5}, []int{2}, []bool{true}},
+		{"daily limit below the per gift limit", Each, 3, 5, 1, 2, []int{5}, []int{2}, []bool{true}},
+		{"daily limit equal to the per gift limit", Each, 3, 5, 1, 3, []int{5}, []int{3}, []bool{false}},
+		{"daily limit runs out on the second receiver", Each, 3, 5, 2, 4, []int{5, 5}, []int{3, 1}, []bool{false, true}},
+		{"split between receivers", Split, 0, 5, 2, 5, []int{3, 2}, []int{3, 2}, []bool{false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.SplitPolicy = test.policy
+			cfg.MaxPerGift = test.maxPerGift
+			requested, given, byDayLimit := allocate(cfg, test.numEmoji, test.numReceivers, test.remaining)
+			if !reflect.DeepEqual(requested, test.wantRequested) || !reflect.DeepEqual(given, test.wantGiven) || !reflect.DeepEqual(byDayLimit, test.wantByDayLimit) {
+				t.Errorf("allocate() = %v, %v, %v, want %v, %v, %v", requested, given, byDayLimit, test.wantRequested, test.wantGiven, test.wantByDayLimit)
+			}
+		})
+	}
+}
+
+func TestKarmaLines(t *testing.T) {
+	tests := []struct {
+		name string
+		line givingLine
+		want [][]string
+	}{
+		{"only mentions followed by karma", givingLine{Receivers: []string{"A", "B"}, Karma: map[string]int{"A": 1}}, [][]string{{"A"}}},
+		{"same karma shares a line", givingLine{Receivers: []string{"A", "B"}, Karma: map[string]int{"A": 1, "B": 1}}, [][]string{{"A", "B"}}},
+		{"different karma on separate lines", givingLine{Receivers: []string{"A", "B", "C"}, Karma: map[string]int{"A": 1, "B": 3, "C": 1}}, [][]string{{"A", "C"}, {"B"}}},
+		{"no karma", givingLine{Receivers: []string{"A"}}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got [][]string
+			for _, line := range karmaLines(test.line) {
+				got = append(got, line.Receivers)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("karmaLines() receivers = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAckReactions(t *testing.T) {
+	tests := []struct {
+		name  string
+		given map[string]int
+		want  []string
+	}{
+		{"nothing given", map[string]int{}, nil},
+		{"one currency", map[string]int{"taco": 3}, []string{"three"}},
+		{"each currency with its number", map[string]int{"taco": 2, "rocket": 1}, []string{"two", "taco", "one", "rocket"}},
+		{"same number for two currencies", map[string]int{"taco": 1, "rocket": 1}, []string{"one", "taco", "one", "rocket"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ackReactions(testConfig(), test.given); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ackReactions(%v) = %v, want %v", test.given, got, test.want)
+			}
+		})
+	}
+}
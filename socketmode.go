@@ -0,0 +1,197 @@
+package p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack/slackevents"
+)
+
+// EnvelopeType Type of a Socket Mode envelope
+type EnvelopeType string
+
+const (
+	// HelloEnvelope Sent by Slack once the connection is ready
+	HelloEnvelope EnvelopeType = "hello"
+	// DisconnectEnvelope Sent by Slack before it closes the connection, e.g. to refresh it
+	DisconnectEnvelope EnvelopeType = "disconnect"
+	// EventsAPIEnvelope Wraps an Events API event
+	EventsAPIEnvelope EnvelopeType = "events_api"
+	// SlashCommandsEnvelope Wraps a slash command
+	SlashCommandsEnvelope EnvelopeType = "slash_commands"
+	// InteractiveEnvelope Wraps an interactivity payload
+	InteractiveEnvelope EnvelopeType = "interactive"
+)
+
+const (
+	minSocketBackoff = time.Second
+	maxSocketBackoff = time.Minute
+)
+
+// envelope A message received over Socket Mode
+type envelope struct {
+	Type       EnvelopeType    `json:"type"`
+	EnvelopeID string          `json:"envelope_id"`
+	Payload    json.RawMessage `json:"payload"`
+	Reason     string          `json:"reason"`
+}
+
+// envelopeAck Acknowledgment of an envelope, with the response of the handler if any
+type envelopeAck struct {
+	EnvelopeID string      `json:"envelope_id"`
+	Payload    interface{} `json:"payload,omitempty"`
+}
+
+// connectionResponse Response of apps.connections.open
+type connectionResponse struct {
+	URL string `json:"url"`
+}
+
+// SocketMode Socket Mode runner feeding events, slash commands and interactivity into the same handlers as Handle
+type SocketMode struct {
+	// ConnectionURL Return the websocket URL to dial, a local stand-in can be used instead of Slack
+	ConnectionURL func() (string, error)
+	Dialer        *websocket.Dialer
+}
+
+// NewSocketMode Create a Socket Mode runner connecting to Slack with the app level token
+func NewSocketMode(appToken string) *SocketMode {
+	return &SocketMode{
+		ConnectionURL: func() (string, error) {
+			var response connectionResponse
+			if err := callAPIAs(appToken, "apps.connections.open", struct{}{}, &response); err != nil {
+				return "", err
+			}
+			return response.URL, nil
+		},
+		Dialer: websocket.DefaultDialer,
+	}
+}
+
+// Run Connect and serve until the context is done, reconnecting with exponential backoff
+func (s *SocketMode) Run(ctx context.Context) error {
+	backoff := minSocketBackoff
+	for {
+		connected, err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = minSocketBackoff
+		}
+		if err == nil {
+			// Slack asked to reconnect
+			continue
+		}
+		log.Printf("Socket Mode connection lost with error %v. Reconnect in %v\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxSocketBackoff {
+			backoff = maxSocketBackoff
+		}
+	}
+}
+
+// connect Open one connection and serve it until it is closed.
+// Whether Slack said hello is returned so the backoff is only kept growing for failed connections.
+func (s *SocketMode) connect(ctx context.Context) (bool, error) {
+	url, err := s.ConnectionURL()
+	if err != nil {
+		return false, fmt.Errorf("unable to open connection: %v", err)
+	}
+	conn, _, err := s.Dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("unable to dial %v: %v", url, err)
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	connected := false
+	for {
+		var e envelope
+		if err := conn.ReadJSON(&e); err != nil {
+			return connected, err
+		}
+		switch e.Type {
+		case HelloEnvelope:
+			log.Println("Socket Mode connected")
+			connected = true
+			continue
+		case DisconnectEnvelope:
+			log.Printf("Socket Mode disconnect requested: %v\n", e.Reason)
+			return connected, nil
+		}
+		response, work := s.handle(e)
+		if err := conn.WriteJSON(envelopeAck{EnvelopeID: e.EnvelopeID, Payload: response}); err != nil {
+			return connected, err
+		}
+		if work != nil {
+			background(work)
+		}
+	}
+}
+
+// handle Dispatch the envelope, returning the response to send with its acknowledgment, if any, and the work to run
+// once it is sent. Slack retries envelopes not acknowledged within 3 seconds, so only modal submissions,
+// whose validation errors must be in the acknowledgment, are handled before it.
+func (s *SocketMode) handle(e envelope) (interface{}, func()) {
+	log.Printf("Envelope %v: %s\n", e.Type, e.Payload)
+	cfg := currentConfig()
+	switch e.Type {
+	case EventsAPIEnvelope:
+		event, err := slackevents.ParseEvent(e.Payload, slackevents.OptionNoVerifyToken())
+		if err != nil {
+			log.Printf("Unable to parse event with error %v\n", err)
+			return nil, nil
+		}
+		return nil, func() { dispatchEvent(cfg, event) }
+	case SlashCommandsEnvelope:
+		var command slashCommand
+		if err := json.Unmarshal(e.Payload, &command); err != nil {
+			log.Printf("Unable to unmarshal command with error %v\n", err)
+			return nil, nil
+		}
+		return nil, func() {
+			if response := handleCommand(cfg, command); response != "" {
+				respondTo(command.ResponseURL, response)
+			}
+		}
+	case InteractiveEnvelope:
+		var payload interactionPayload
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			log.Printf("Unable to unmarshal interaction payload with error %v\n", err)
+			return nil, nil
+		}
+		if payload.Type != ViewSubmission {
+			return nil, func() {
+				if _, err := interactions.route(cfg, payload); err != nil {
+					log.Printf("Unable to route interaction with error %v\n", err)
+				}
+			}
+		}
+		response, err := interactions.route(cfg, payload)
+		if err != nil {
+			log.Printf("Unable to route interaction with error %v\n", err)
+			return nil, nil
+		}
+		return response, nil
+	default:
+		log.Printf("Strange envelope type %v\n", e.Type)
+	}
+	return nil, nil
+}
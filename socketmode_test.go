@@ -0,0 +1,92 @@
+package p
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSocketModeAcknowledgesAndReconnects(t *testing.T) {
+	activeConfig.Lock()
+	activeConfig.base = testConfig()
+	activeConfig.config = activeConfig.base
+	activeConfig.Unlock()
+	activeConfig.loaded.Do(func() {})
+
+	connections := make(chan *websocket.Conn)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Unable to upgrade with error %v", err)
+			return
+		}
+		connections <- conn
+	}))
+	defer server.Close()
+
+	s := &SocketMode{
+		ConnectionURL: func() (string, error) { return "ws" + strings.TrimPrefix(server.URL, "http"), nil },
+		Dialer:        websocket.DefaultDialer,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() { result <- s.Run(ctx) }()
+
+	first := accept(t, connections)
+	defer first.Close()
+	send(t, first, map[string]interface{}{"type": "hello"})
+	send(t, first, map[string]interface{}{
+		"type":        "events_api",
+		"envelope_id": "envelope-1",
+		"payload":     map[string]string{"type": "url_verification", "challenge": "x", "token": "t"},
+	})
+	var ack envelopeAck
+	first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := first.ReadJSON(&ack); err != nil {
+		t.Fatalf("Unable to read acknowledgment with error %v", err)
+	}
+	if ack.EnvelopeID != "envelope-1" || ack.Payload != nil {
+		t.Errorf("acknowledgment = %+v, want envelope-1 without payload", ack)
+	}
+	send(t, first, map[string]interface{}{"type": "disconnect", "reason": "refresh_requested"})
+
+	second := accept(t, connections)
+	defer second.Close()
+	send(t, second, map[string]interface{}{"type": "hello"})
+	cancel()
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("Run() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return once the context was canceled")
+	}
+}
+
+// accept Wait for the runner to connect
+func accept(t *testing.T, connections chan *websocket.Conn) *websocket.Conn {
+	t.Helper()
+	select {
+	case conn := <-connections:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner did not connect")
+		return nil
+	}
+}
+
+// send Write the envelope as Slack would
+func send(t *testing.T, conn *websocket.Conn, e map[string]interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(e); err != nil {
+		t.Fatalf("Unable to send %v with error %v", e, err)
+	}
+}
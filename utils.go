@@ -2,7 +2,6 @@ package p
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,22 +24,13 @@ var countryTz = map[string]string{
 	"Vietnam": "Asia/Ho_Chi_Minh",
 }
 
-//	timeIn Return time in location
-func timeIn(name string, t time.Time) time.Time {
-	location, err := time.LoadLocation(countryTz[name])
-	if err != nil {
-		log.Panicf("Error loading location %v", name)
-	}
-	return t.In(location)
-}
-
 // toDate Convert epoch timestamp to time.Time
-func toDate(timestamp string) time.Time {
+func toDate(timestamp string) (time.Time, error) {
 	i, err := strconv.ParseInt(timestamp, 10, 64)
 	if err != nil {
-		log.Fatalf("Error parsing timestamp: %s", timestamp)
+		return time.Time{}, fmt.Errorf("error parsing timestamp: %s", timestamp)
 	}
-	return time.Unix(i, 0)
+	return time.Unix(i, 0), nil
 }
 
 func isInRange(t time.Time, start Date, end Date) bool {
@@ -78,21 +68,20 @@ func (p Pair) String() string {
 }
 func (p ChartRecords) String() string {
 	var arr []string
-	for _, pair := range p {
-		arr = append(arr, pair.String())
-	}
-	if len(arr) >= 1 {
-		arr[0] = fmt.Sprintf(chartFormat, arr[0], ":crown:")
-	}
-	if len(arr) >= 2 {
-		arr[1] = fmt.Sprintf(chartFormat, arr[1], ":rocket:")
-	}
-	if len(arr) >= 3 {
-		arr[2] = fmt.Sprintf(chartFormat, arr[2], ":trident:")
+	for i := range p {
+		arr = append(arr, p.line(i))
 	}
 	return strings.Join(arr, "\n")
 }
 
+// line Render the record at rank i with its medal if any
+func (p ChartRecords) line(i int) string {
+	if i < len(medals) {
+		return fmt.Sprintf(chartFormat, p[i].String(), medals[i])
+	}
+	return p[i].String()
+}
+
 var emojiTexts = map[int]string{
 	0:  "zero",
 	1:  "one",
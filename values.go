@@ -0,0 +1,107 @@
+package p
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// hashtagPattern Compile hashtag pattern first for better performance
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\w&])#([\w\-]+)`)
+
+const valueFormat = "#%s (%d)"
+const statsFormat = "*%s*: %s"
+const noValueMessage = "no value tagged"
+
+// valueNamed Find the company value with the case insensitive name, with or without #
+func (cfg *Config) valueNamed(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimPrefix(name, "#"))
+	for _, value := range cfg.Values {
+		if value == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// findValuesIn Find the company values hashtagged in text, without duplicates
+func (cfg *Config) findValuesIn(text string) []string {
+	var result []string
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		value, ok := cfg.valueNamed(match[1])
+		if !ok {
+			continue
+		}
+		if !containsString(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// containsString Whether the slice contains the string
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getStats Break down what each receiver got in range by company value.
+// Only the receiver with the name is included when it is not empty.
+func getStats(t *team, from Date, to Date, query chartQuery, receiverName string) (map[string]map[string]int, error) {
+	log.Printf("Stats from: %v, to %v, query %+v, receiver %v\n", from, to, query, receiverName)
+	stats := map[string]map[string]int{}
+	entries, err := readLedger(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if receiverName != "" && entry.Receiver != receiverName {
+			continue
+		}
+		if !query.matches(t.Config, entry, from, to) {
+			continue
+		}
+		if stats[entry.Receiver] == nil {
+			stats[entry.Receiver] = map[string]int{}
+		}
+		for _, tag := range entry.Tags {
+			stats[entry.Receiver][tag] += query.value(t.Config, entry)
+		}
+	}
+	log.Printf("Stats: %v\n", stats)
+	return stats, nil
+}
+
+// formatStats Render the value breakdown of each receiver, most valued receiver first
+func formatStats(stats map[string]map[string]int) string {
+	var lines []string
+	for _, person := range rankStats(stats) {
+		values := rank(stats[person.Key])
+		var parts []string
+		for _, value := range values {
+			parts = append(parts, fmt.Sprintf(valueFormat, value.Key, value.Value))
+		}
+		if len(parts) == 0 {
+			parts = append(parts, noValueMessage)
+		}
+		lines = append(lines, fmt.Sprintf(statsFormat, person.Key, strings.Join(parts, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rankStats Rank receivers by their total of tagged quantities
+func rankStats(stats map[string]map[string]int) ChartRecords {
+	totals := map[string]int{}
+	for person, values := range stats {
+		totals[person] = 0
+		for _, total := range values {
+			totals[person] += total
+		}
+	}
+	return rank(totals)
+}
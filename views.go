@@ -0,0 +1,131 @@
+package p
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// view A Block Kit modal or home tab view
+type view struct {
+	Type            string      `json:"type"`
+	CallbackID      string      `json:"callback_id,omitempty"`
+	Title           *textObject `json:"title,omitempty"`
+	Submit          *textObject `json:"submit,omitempty"`
+	Close           *textObject `json:"close,omitempty"`
+	PrivateMetadata string      `json:"private_metadata,omitempty"`
+	Blocks          []block     `json:"blocks"`
+}
+
+// option A Block Kit select option
+type option struct {
+	Text  *textObject `json:"text"`
+	Value string      `json:"value"`
+}
+
+// selectElement A Block Kit static, users or multi users select element
+type selectElement struct {
+	Type          string      `json:"type"`
+	ActionID      string      `json:"action_id"`
+	Placeholder   *textObject `json:"placeholder,omitempty"`
+	Options       []option    `json:"options,omitempty"`
+	InitialOption *option     `json:"initial_option,omitempty"`
+	InitialUsers  []string    `json:"initial_users,omitempty"`
+}
+
+// plainTextInput A Block Kit plain text input element
+type plainTextInput struct {
+	Type         string `json:"type"`
+	ActionID     string `json:"action_id"`
+	Multiline    bool   `json:"multiline,omitempty"`
+	InitialValue string `json:"initial_value,omitempty"`
+	MaxLength    int    `json:"max_length,omitempty"`
+}
+
+// viewErrors Response to a view submission showing errors by input block id
+type viewErrors struct {
+	ResponseAction string            `json:"response_action"`
+	Errors         map[string]string `json:"errors"`
+}
+
+// apiResponse Common part of Slack Web API responses
+type apiResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// newViewErrors Create a view submission response showing the errors
+func newViewErrors(errors map[string]string) viewErrors {
+	return viewErrors{ResponseAction: "errors", Errors: errors}
+}
+
+// newOption Create a select option with the same text and value
+func newOption(text string, value string) option {
+	return option{Text: plainText(text), Value: value}
+}
+
+// callAPI Call a Slack Web API method of the workspace with a JSON body, for methods the library does not support
+func callAPI(t *team, method string, request interface{}) error {
+	return callAPIAs(t.Token, method, request, nil)
+}
+
+// callAPIAs Call a Slack Web API method with the token, decoding the response into result if not nil
+func callAPIAs(token string, method string, request interface{}, result interface{}) error {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://slack.com/api/"+method, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var response apiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if !response.OK {
+		return fmt.Errorf("%s failed: %s", method, response.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(body, result)
+	}
+	return nil
+}
+
+// openView Open a modal for the trigger, returning its view id or an empty string if it could not be opened
+func openView(t *team, triggerID string, modal view) string {
+	var opened struct {
+		View struct {
+			ID string `json:"id"`
+		} `json:"view"`
+	}
+	err := callAPIAs(t.Token, "views.open", map[string]interface{}{"trigger_id": triggerID, "view": modal}, &opened)
+	if err != nil {
+		log.Printf("Unable to open view %v with error %v\n", modal.CallbackID, err)
+		return ""
+	}
+	log.Printf("View %v opened\n", modal.CallbackID)
+	return opened.View.ID
+}
+
+// updateView Replace an opened modal
+func updateView(t *team, viewID string, modal view) {
+	err := callAPI(t, "views.update", map[string]interface{}{"view_id": viewID, "view": modal})
+	if err != nil {
+		log.Printf("Unable to update view %v with error %v\n", modal.CallbackID, err)
+	}
+}
@@ -0,0 +1,340 @@
+package p
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+	"google.golang.org/api/sheets/v4"
+)
+
+// installationsSheet Sheet storing the workspaces the app is installed in, one row per team:
+// Team id, Team name, Bot token, Bot user id, Scopes, Installed at.
+// Bot tokens are sealed with a key derived from SLACK_CLIENT_SECRET, so reading the spreadsheet is not enough to act as the app.
+const installationsSheet = "Installations"
+
+// installationsColumns Number of columns of an installation row
+const installationsColumns = 6
+
+// botScopes Bot scopes requested when installing the app
+const botScopes = "app_mentions:read,channels:history,channels:read,chat:write,commands,groups:history,groups:read,im:read,im:write,mpim:read,reactions:write,usergroups:read,users:read"
+
+// oauthStateMaxAge How long an install link stays valid
+const oauthStateMaxAge = 10 * time.Minute
+
+// missingTeamTTL How long a team without installation is remembered, so unknown teams do not read the sheet on every request
+const missingTeamTTL = time.Minute
+
+// sealedTokenPrefix Marks bot tokens sealed with AES-GCM, rows saved before tokens were sealed hold them in clear
+const sealedTokenPrefix = "sealed:"
+
+const installedMessage = "Installed in %s. You can close this page."
+
+// team Slack workspace a request came from, with the client acting in it
+type team struct {
+	ID        string
+	Name      string
+	Token     string
+	BotUserID string
+	Scopes    string
+	// Legacy Installed with SLACK_TOKEN before workspaces were stored, it owns the ledger rows without a team
+	Legacy bool
+	// Config Configuration of the request being handled in the workspace
+	Config *Config
+	client *slack.Client
+}
+
+// teams Cache of the workspaces by team id
+var teams = struct {
+	sync.Mutex
+	byID map[string]*team
+	// missing When teams without installation were looked up
+	missing map[string]time.Time
+	legacy  *team
+}{byID: map[string]*team{}, missing: map[string]time.Time{}}
+
+// newTeam Create a team acting with the bot token
+func newTeam(id string, name string, token string, botUserID string, scopes string) *team {
+	return &team{ID: id, Name: name, Token: token, BotUserID: botUserID, Scopes: scopes, client: slack.New(token)}
+}
+
+// legacyTeam The workspace of SLACK_TOKEN, nil when it is not configured or can not be reached
+func legacyTeam(cfg *Config) *team {
+	teams.Lock()
+	defer teams.Unlock()
+	if teams.legacy != nil {
+		return teams.legacy
+	}
+	if cfg.SlackToken == "" {
+		return nil
+	}
+	t := newTeam("", "", cfg.SlackToken, "", "")
+	auth, err := t.client.AuthTest()
+	if err != nil {
+		log.Printf("Unable to identify the workspace of SLACK_TOKEN with error %v\n", err)
+		return nil
+	}
+	t.ID = auth.TeamID
+	t.Name = auth.Team
+	t.BotUserID = auth.UserID
+	t.Legacy = true
+	teams.legacy = t
+	return t
+}
+
+// teamFor Resolve the workspace of the team id from the installations, falling back to SLACK_TOKEN.
+// The team handles the request with the configuration.
+func teamFor(cfg *Config, teamID string) *team {
+	teams.Lock()
+	t, ok := teams.byID[teamID]
+	missing, known := teams.missing[teamID]
+	teams.Unlock()
+	if ok {
+		return t.with(cfg)
+	}
+	if !known || time.Since(missing) >= missingTeamTTL {
+		if t, ok := readInstallations(cfg)[teamID]; ok {
+			teams.Lock()
+			teams.byID[teamID] = t
+			delete(teams.missing, teamID)
+			teams.Unlock()
+			return t.with(cfg)
+		}
+		teams.Lock()
+		teams.missing[teamID] = time.Now()
+		teams.Unlock()
+	}
+	if legacy := legacyTeam(cfg); legacy != nil && (teamID == "" || teamID == legacy.ID) {
+		return legacy.with(cfg)
+	}
+	log.Printf("App is not installed in team %v\n", teamID)
+	return nil
+}
+
+// with Copy of the cached team handling a request with the configuration
+func (t *team) with(cfg *Config) *team {
+	copy := *t
+	copy.Config = cfg
+	return &copy
+}
+
+// owns Whether the ledger entry belongs to the workspace
+func (t *team) owns(entry ledgerEntry) bool {
+	return entry.Team == t.ID || (entry.Team == "" && t.Legacy)
+}
+
+// readInstallations Read every installation row by team id
+func readInstallations(cfg *Config) map[string]*team {
+	result := map[string]*team{}
+	response, err := sheetsService().Spreadsheets.Values.Get(cfg.SpreadsheetID, installationsSheet+"!A2:F").Do()
+	if err != nil {
+		log.Printf("Unable to read installations with error %v\n", err)
+		return result
+	}
+	for _, row := range response.Values {
+		cells := make([]string, installationsColumns)
+		for i := 0; i < len(row) && i < installationsColumns; i++ {
+			cells[i] = fmt.Sprintf("%v", row[i])
+		}
+		if cells[0] == "" || cells[2] == "" {
+			continue
+		}
+		token, err := openToken(cfg, cells[2])
+		if err != nil {
+			log.Printf("Unable to open the bot token of team %v with error %v\n", cells[0], err)
+			continue
+		}
+		// Later rows are reinstallations
+		result[cells[0]] = newTeam(cells[0], cells[1], token, cells[3], cells[4])
+	}
+	return result
+}
+
+// saveInstallation Append the installation and cache it, a reinstallation replaces the previous one
+func saveInstallation(cfg *Config, t *team) error {
+	token, err := sealToken(cfg, t.Token)
+	if err != nil {
+		return err
+	}
+	var valueRange sheets.ValueRange
+	valueRange.Values = append(valueRange.Values, []interface{}{t.ID, t.Name, token, t.BotUserID, t.Scopes, time.Now().Format(time.RFC3339)})
+	_, err = sheetsService().Spreadsheets.Values.Append(cfg.SpreadsheetID, installationsSheet+"!A2", &valueRange).ValueInputOption("RAW").Do()
+	if err != nil {
+		return err
+	}
+	teams.Lock()
+	teams.byID[t.ID] = t
+	delete(teams.missing, t.ID)
+	teams.Unlock()
+	return nil
+}
+
+// tokenCipher AES-GCM keyed from the client secret, a distinct key than the one signing OAuth states
+func tokenCipher(cfg *Config) (cipher.AEAD, error) {
+	if cfg.ClientSecret == "" {
+		return nil, fmt.Errorf("SLACK_CLIENT_SECRET is not configured")
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.ClientSecret))
+	mac.Write([]byte("installation token"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealToken Encrypt the bot token to store it in the sheet, the nonce is stored in front of it
+func sealToken(cfg *Config, token string) (string, error) {
+	aead, err := tokenCipher(cfg)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), nil)
+	return sealedTokenPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openToken Decrypt the bot token stored in the sheet, tokens stored before they were sealed are returned as is
+func openToken(cfg *Config, stored string) (string, error) {
+	if !strings.HasPrefix(stored, sealedTokenPrefix) {
+		log.Println("Bot token stored in clear, reinstall the app to seal it")
+		return stored, nil
+	}
+	aead, err := tokenCipher(cfg)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedTokenPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("sealed token is too short")
+	}
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// oauthState Sign the time so the redirect can tell the install started here, without storing it
+func oauthState(cfg *Config, now time.Time) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(cfg.ClientSecret))
+	mac.Write([]byte(timestamp))
+	return timestamp + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyOAuthState Check the state was signed here recently
+func verifyOAuthState(cfg *Config, state string, now time.Time) error {
+	parts := strings.Split(state, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("malformed state %v", state)
+	}
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed state %v", state)
+	}
+	issued := time.Unix(seconds, 0)
+	if now.Sub(issued) > oauthStateMaxAge {
+		return fmt.Errorf("state issued at %v expired", issued)
+	}
+	if !hmac.Equal([]byte(oauthState(cfg, issued)), []byte(state)) {
+		return fmt.Errorf("state signature mismatch")
+	}
+	return nil
+}
+
+// HandleInstall handle install requests by redirecting to the Slack OAuth v2 authorization page
+func HandleInstall(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		log.Println("SLACK_CLIENT_ID and SLACK_CLIENT_SECRET are not configured")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	query := url.Values{
+		"client_id": {cfg.ClientID},
+		"scope":     {botScopes},
+		"state":     {oauthState(cfg, time.Now())},
+	}
+	if cfg.RedirectURL != "" {
+		query.Set("redirect_uri", cfg.RedirectURL)
+	}
+	http.Redirect(w, r, "https://slack.com/oauth/v2/authorize?"+query.Encode(), http.StatusFound)
+}
+
+// oauthAccessResponse Response of oauth.v2.access, only the fields used by this app
+type oauthAccessResponse struct {
+	apiResponse
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	BotUserID   string `json:"bot_user_id"`
+	Team        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"team"`
+}
+
+// HandleOAuthRedirect handle the OAuth v2 redirect by exchanging the code for a bot token and storing the installation
+func HandleOAuthRedirect(w http.ResponseWriter, r *http.Request) {
+	cfg := currentConfig()
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		log.Printf("Installation cancelled: %v\n", reason)
+		http.Error(w, "Installation cancelled.", http.StatusOK)
+		return
+	}
+	if err := verifyOAuthState(cfg, query.Get("state"), time.Now()); err != nil {
+		log.Printf("Unable to verify OAuth state with error %v\n", err)
+		http.Error(w, "Invalid install link, please start again.", http.StatusBadRequest)
+		return
+	}
+	form := url.Values{
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code":          {query.Get("code")},
+	}
+	if cfg.RedirectURL != "" {
+		form.Set("redirect_uri", cfg.RedirectURL)
+	}
+	resp, err := http.PostForm("https://slack.com/api/oauth.v2.access", form)
+	if err != nil {
+		log.Printf("Unable to exchange OAuth code with error %v\n", err)
+		http.Error(w, "Unable to install, please try again.", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	var access oauthAccessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&access); err != nil || !access.OK {
+		log.Printf("Unable to exchange OAuth code with error %v %v\n", err, access.Error)
+		http.Error(w, "Unable to install, please try again.", http.StatusBadGateway)
+		return
+	}
+	t := newTeam(access.Team.ID, access.Team.Name, access.AccessToken, access.BotUserID, access.Scope)
+	if err := saveInstallation(cfg, t); err != nil {
+		log.Printf("Unable to save installation of team %v with error %v\n", t.ID, err)
+		http.Error(w, "Unable to install, please try again.", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Installed in team %v %v\n", t.ID, t.Name)
+	fmt.Fprintf(w, installedMessage, t.Name)
+}
@@ -0,0 +1,30 @@
+package p
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSealToken(t *testing.T) {
+	cfg := &Config{ClientSecret: "secret"}
+	sealed, err := sealToken(cfg, "xoxb-token")
+	if err != nil {
+		t.Fatalf("sealToken() error = %v", err)
+	}
+	if strings.Contains(sealed, "xoxb-token") || !strings.HasPrefix(sealed, sealedTokenPrefix) {
+		t.Fatalf("sealToken() = %v, want the token sealed", sealed)
+	}
+	if token, err := openToken(cfg, sealed); err != nil || token != "xoxb-token" {
+		t.Errorf("openToken() = %v, %v, want xoxb-token", token, err)
+	}
+	if _, err := openToken(&Config{ClientSecret: "other"}, sealed); err == nil {
+		t.Error("openToken() with another secret succeeded")
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := openToken(cfg, tampered); err == nil {
+		t.Error("openToken() of a tampered token succeeded")
+	}
+	if token, err := openToken(cfg, "xoxb-clear"); err != nil || token != "xoxb-clear" {
+		t.Errorf("openToken() of a token in clear = %v, %v, want xoxb-clear", token, err)
+	}
+}